@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jadilet/taximicroservice/pkg/queues"
+	"github.com/joho/godotenv"
+	"github.com/streadway/amqp"
+)
+
+// dlq inspects, replays or purges the dead letter queues
+//
+//	dlq -queue open_ride_queue -action inspect -n 10
+//	dlq -queue waiting_driver_response -action replay
+//	dlq -queue open_ride_queue -action purge
+func main() {
+	var (
+		queue  = flag.String("queue", "open_ride_queue", "queue whose dead letter queue is handled")
+		action = flag.String("action", "inspect", "inspect, replay or purge")
+		limit  = flag.Int("n", 10, "max messages to inspect or replay, 0 for all")
+	)
+	flag.Parse()
+
+	err := godotenv.Load()
+
+	var logger log.Logger
+	{
+		logger = log.NewLogfmtLogger(os.Stderr)
+		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+	}
+
+	if err != nil {
+		logger.Log("Error while reading the .env file")
+	}
+
+	url := fmt.Sprintf("%s://%s:%s@%s:%s/",
+		os.Getenv("RABBITMQ_PROTOCOL"),
+		os.Getenv("RABBITMQ_USER"),
+		os.Getenv("RABBITMQ_PASSWORD"),
+		os.Getenv("RABBITMQ_HOST"),
+		os.Getenv("RABBITMQ_PORT"),
+	)
+
+	conn, err := amqp.Dial(url)
+
+	if err != nil {
+		logger.Log("Failed to connect to RabbitMQ", err)
+		os.Exit(1)
+	}
+
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+
+	if err != nil {
+		logger.Log("Failed to open a channel", err)
+		os.Exit(1)
+	}
+
+	defer ch.Close()
+
+	dlq := queues.DeadLetterQueue(*queue)
+
+	switch *action {
+	case "inspect":
+		err = inspect(ch, dlq, *limit)
+	case "replay":
+		err = replay(ch, dlq, *queue, *limit)
+	case "purge":
+		var n int
+		n, err = ch.QueuePurge(dlq, false)
+		logger.Log("queue", dlq, "purged", n)
+	default:
+		err = fmt.Errorf("unknown action %q", *action)
+	}
+
+	if err != nil {
+		logger.Log("queue", dlq, "action", *action, "err", err)
+		os.Exit(1)
+	}
+}
+
+// inspect prints the messages and leaves them in the queue
+func inspect(ch *amqp.Channel, dlq string, limit int) error {
+	var last uint64
+
+	for i := 0; limit == 0 || i < limit; i++ {
+		d, ok, err := ch.Get(dlq, false)
+
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			break
+		}
+
+		last = d.DeliveryTag
+		fmt.Printf("#%d headers=%v\n%s\n\n", i+1, d.Headers["x-death"], d.Body)
+	}
+
+	if last == 0 {
+		fmt.Println("no messages in", dlq)
+		return nil
+	}
+
+	// put them back
+	return ch.Nack(last, true, true)
+}
+
+// replay moves the messages back to the queue with a fresh retry count
+func replay(ch *amqp.Channel, dlq, queue string, limit int) error {
+	n := 0
+
+	for ; limit == 0 || n < limit; n++ {
+		d, ok, err := ch.Get(dlq, false)
+
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			break
+		}
+
+		headers := amqp.Table{}
+		for k, v := range d.Headers {
+			if k != "x-death" {
+				headers[k] = v
+			}
+		}
+
+		err = ch.Publish(
+			"",
+			queue,
+			false,
+			false,
+			amqp.Publishing{
+				Headers:      headers,
+				DeliveryMode: amqp.Persistent,
+				ContentType:  d.ContentType,
+				Body:         d.Body,
+			})
+
+		if err != nil {
+			if err := d.Nack(false, true); err != nil {
+				return err
+			}
+			return err
+		}
+
+		if err := d.Ack(false); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("replayed", n, "messages from", dlq, "to", queue)
+	return nil
+}
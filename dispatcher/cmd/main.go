@@ -2,21 +2,32 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/jadilet/taximicroservice/dispatcher/service"
 	dClient "github.com/jadilet/taximicroservice/drivermanagement/pb"
 	"github.com/jadilet/taximicroservice/location/pb"
+	"github.com/jadilet/taximicroservice/pkg/cancelled"
+	"github.com/jadilet/taximicroservice/pkg/mtls"
+	"github.com/jadilet/taximicroservice/pkg/queues"
 	"github.com/joho/godotenv"
 	"github.com/streadway/amqp"
 	"google.golang.org/grpc"
 )
 
+// cancelledTTL is how long the cancelled rides are remembered,
+// the rides older than an hour are dropped anyway
+const cancelledTTL = 2 * time.Hour
+
 func main() {
 
 	err := godotenv.Load()
@@ -41,6 +52,122 @@ func main() {
 		return
 	}
 
+	// DISPATCHER_RADIUS_STEPS: km, comma separated e.g. 1,3,5
+	// the search widens after every attempt without drivers, DISPATCHER_RADIUS by default
+	// DISPATCHER_MAX_ATTEMPTS: searches without drivers before giving up, 10 by default
+	// DISPATCHER_MAX_ROUNDS: rounds of offers nobody accepted before giving up, 20 by default,
+	// the sequential strategy offers the ride to one driver per round
+	// DISPATCHER_RETRY_DELAY: seconds between the attempts, 10 by default
+	// DISPATCHER_NEAREST_LIMIT: nearest drivers considered per search, 20 by default, 0 for all
+	search := service.SearchConfig{Radii: []float64{radius}, MaxAttempts: 10, MaxRounds: 20,
+		RetryDelay: 10 * time.Second, Limit: 20}
+
+	if v := os.Getenv("DISPATCHER_RADIUS_STEPS"); v != "" {
+		search.Radii = nil
+
+		for _, step := range strings.Split(v, ",") {
+			r, err := strconv.ParseFloat(strings.TrimSpace(step), 64)
+
+			if err != nil || r <= 0 {
+				logger.Log("DISPATCHER_RADIUS_STEPS must be positive numbers", v)
+				return
+			}
+
+			search.Radii = append(search.Radii, r)
+		}
+	}
+
+	if v := os.Getenv("DISPATCHER_MAX_ATTEMPTS"); v != "" {
+		search.MaxAttempts, err = strconv.Atoi(v)
+
+		if err != nil || search.MaxAttempts <= 0 {
+			logger.Log("DISPATCHER_MAX_ATTEMPTS must be a positive number", v)
+			return
+		}
+	}
+
+	if v := os.Getenv("DISPATCHER_MAX_ROUNDS"); v != "" {
+		search.MaxRounds, err = strconv.Atoi(v)
+
+		if err != nil || search.MaxRounds <= 0 {
+			logger.Log("DISPATCHER_MAX_ROUNDS must be a positive number", v)
+			return
+		}
+	}
+
+	if v := os.Getenv("DISPATCHER_RETRY_DELAY"); v != "" {
+		sec, err := strconv.Atoi(v)
+
+		if err != nil || sec <= 0 {
+			logger.Log("DISPATCHER_RETRY_DELAY must be a positive number of seconds", v)
+			return
+		}
+
+		search.RetryDelay = time.Duration(sec) * time.Second
+	}
+
+	if v := os.Getenv("DISPATCHER_NEAREST_LIMIT"); v != "" {
+		search.Limit, err = strconv.Atoi(v)
+
+		if err != nil || search.Limit < 0 {
+			logger.Log("DISPATCHER_NEAREST_LIMIT must be a non negative number", v)
+			return
+		}
+	}
+
+	// DISPATCHER_OFFER_STRATEGY: broadcast (default), sequential or batched
+	// DISPATCHER_OFFER_TIMEOUT: seconds the drivers have to accept, 15 by default
+	// DISPATCHER_BATCH_SIZE: drivers in the first batch of the batched strategy, 3 by default
+	offerTimeout := 15 * time.Second
+	if v := os.Getenv("DISPATCHER_OFFER_TIMEOUT"); v != "" {
+		sec, err := strconv.Atoi(v)
+
+		if err != nil || sec <= 0 {
+			logger.Log("DISPATCHER_OFFER_TIMEOUT must be a positive number of seconds", v)
+			return
+		}
+
+		offerTimeout = time.Duration(sec) * time.Second
+	}
+
+	batchSize := 3
+	if v := os.Getenv("DISPATCHER_BATCH_SIZE"); v != "" {
+		batchSize, err = strconv.Atoi(v)
+
+		if err != nil {
+			logger.Log("DISPATCHER_BATCH_SIZE must be a number", err)
+			return
+		}
+	}
+
+	strategy, err := service.NewOfferStrategy(os.Getenv("DISPATCHER_OFFER_STRATEGY"), offerTimeout, batchSize)
+
+	if err != nil {
+		logger.Log("DISPATCHER_OFFER_STRATEGY", err)
+		return
+	}
+
+	// DISPATCHER_RESPONSE_WINDOWS: per region response timeouts, JSON e.g.
+	// [{"name":"airport","min_lat":43.34,"min_lon":77.0,"max_lat":43.36,"max_lon":77.05,"timeout":30}]
+	var windows []service.ResponseWindow
+	timeouts := []time.Duration{strategy.Timeout()}
+
+	if v := os.Getenv("DISPATCHER_RESPONSE_WINDOWS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &windows); err != nil {
+			logger.Log("DISPATCHER_RESPONSE_WINDOWS must be a JSON list of regions", err)
+			return
+		}
+
+		for _, w := range windows {
+			if w.Timeout <= 0 {
+				logger.Log("DISPATCHER_RESPONSE_WINDOWS timeout must be positive", w.Name)
+				return
+			}
+
+			timeouts = append(timeouts, time.Duration(w.Timeout)*time.Second)
+		}
+	}
+
 	url := fmt.Sprintf("%s://%s:%s@%s:%s/",
 		os.Getenv("RABBITMQ_PROTOCOL"),
 		os.Getenv("RABBITMQ_USER"),
@@ -68,6 +195,8 @@ func main() {
 
 	defer ch.Close()
 
+	// rejected rides are parked in open_ride_queue.dlq by the rides.dlx exchange,
+	// the rides-dlx policy sets it, see dispatcher/deployments/rabbitmq
 	_, err = ch.QueueDeclare(
 		"open_ride_queue", // name
 		true,              // durable
@@ -82,6 +211,39 @@ func main() {
 		return
 	}
 
+	err = queues.DeclareDeadLetterQueue(ch, "open_ride_queue")
+
+	if err != nil {
+		logger.Log("Failed to declare a dead letter queue of open_ride_queue", err)
+		return
+	}
+
+	err = queues.DeclareRetryQueues(ch, "open_ride_queue")
+
+	if err != nil {
+		logger.Log("Failed to declare the retry queues of open_ride_queue", err)
+		return
+	}
+
+	// open_ride_delay: rides without drivers wait here for the retry delay
+	// then go back to open_ride_queue
+	_, err = ch.QueueDeclare(
+		"open_ride_delay", // name
+		true,              // durable
+		false,             // delete when unused
+		false,             // exclusive
+		false,             // no-wait
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": "open_ride_queue",
+		},
+	)
+
+	if err != nil {
+		logger.Log("Failed to declare a queue open_ride_delay", err)
+		return
+	}
+
 	_, err = ch.QueueDeclare(
 		"waiting_driver_response",
 		true,
@@ -96,6 +258,32 @@ func main() {
 		return
 	}
 
+	// waiting_driver_response.delay.<timeout>: the rides wait for the driver response
+	// then go to waiting_driver_response
+	err = service.DeclareResponseQueues(ch, timeouts)
+
+	if err != nil {
+		logger.Log("Failed to declare the waiting_driver_response delay queues", err)
+		return
+	}
+
+	// ride_events: ride status changes published by the services
+	// e.g. ride.cancelled when the passenger cancels the ride
+	err = ch.ExchangeDeclare(
+		"ride_events", // name
+		"topic",       // type
+		true,          // durable
+		false,         // auto-deleted
+		false,         // internal
+		false,         // no-wait
+		nil,           // arguments
+	)
+
+	if err != nil {
+		logger.Log("Failed to declare an exchange ride_events", err)
+		return
+	}
+
 	err = ch.Qos(
 		1,     // prefetch count
 		0,     // prefetch size
@@ -107,7 +295,16 @@ func main() {
 		return
 	}
 
-	var opts []grpc.DialOption = []grpc.DialOption{grpc.WithInsecure()}
+	// GRPC_TLS_CERT_FILE, GRPC_TLS_KEY_FILE, GRPC_TLS_CA_FILE: see mtls.FromEnv,
+	// the certificate of the dispatcher lets it send the rides to the drivers
+	tlsConfig, err := mtls.FromEnv()
+
+	if err != nil {
+		logger.Log("Failed to load the gRPC TLS configuration", err)
+		return
+	}
+
+	var opts []grpc.DialOption = []grpc.DialOption{tlsConfig.DialOption()}
 	addr := fmt.Sprintf("%s:%s",
 		os.Getenv("GRPC_LOCATION_SRV_NAME"),
 		os.Getenv("GRPC_LOCATION_SRV_PORT"))
@@ -137,8 +334,29 @@ func main() {
 
 	driverClient := dClient.NewDriverClient(grpcDriverSrvConn)
 
+	// REDIS_CLUSTER_ADDRS or REDIS_HOST, REDIS_PORT, REDIS_DB, REDIS_USER, REDIS_PASSWORD:
+	// the redis of the cancelled rides, see cancelled.FromEnv
+	cancelledRides, err := cancelled.FromEnv(cancelledTTL)
+
+	if err != nil {
+		logger.Log("Failed to connect the cancelled rides redis", err)
+		return
+	}
+
+	if !cancelledRides.Shared() {
+		level.Warn(logger).Log("msg", "the replicas don't share the cancelled rides, redis isn't configured")
+	}
+
 	s := service.NewDispatcherService(logger, ch,
-		locationClient, driverClient, radius)
+		locationClient, driverClient, search, strategy, windows, cancelledRides)
+
+	err = cancelled.Watch(context.Background(), ch, cancelledRides, "dispatcher_ride_cancelled", logger)
+
+	if err != nil {
+		logger.Log("WatchCancellations func failed", err)
+		return
+	}
+
 	err = s.Dispatch(context.Background())
 
 	if err != nil {
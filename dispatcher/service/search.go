@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jadilet/taximicroservice/location/pb"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// attemptsHeader counts the searches which didn't find any driver
+	attemptsHeader = "x-dispatch-attempts"
+	// roundsHeader counts the rounds of offers nobody accepted
+	roundsHeader = "x-dispatch-rounds"
+)
+
+// SearchConfig configures the driver search of the ride
+type SearchConfig struct {
+	Radii       []float64     // km, the search widens after every attempt without drivers
+	MaxAttempts int           // attempts without drivers before giving up
+	MaxRounds   int           // rounds of offers nobody accepted before giving up
+	RetryDelay  time.Duration // wait between the attempts
+	Limit       int           // nearest drivers considered per search, 0 for every driver in the radius
+}
+
+// radius returns the search radius of the attempt
+func (c SearchConfig) radius(attempts int) float64 {
+	if attempts >= len(c.Radii) {
+		return c.Radii[len(c.Radii)-1]
+	}
+
+	return c.Radii[attempts]
+}
+
+// nearest returns the drivers around the ride who haven't seen it yet,
+// when every driver around has seen the ride the offers start over
+func (s *dispatcherService) nearest(ctx context.Context, ride *Ride, radius float64) ([]*pb.GeoLocation, error) {
+	req := &pb.GeoRequest{Lat: ride.Lat, Lon: ride.Lon, Radius: radius,
+		Limit: int32(s.search.Limit), ExcludeIds: ride.Offered}
+
+	if ride.VehicleClass != "" {
+		req.Filters = map[string]string{"vehicle_class": ride.VehicleClass}
+	}
+
+	resp, err := s.locationClient.Nearest(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Locations) != 0 || len(ride.Offered) == 0 {
+		return resp.Locations, nil
+	}
+
+	ride.Offered = nil
+	ride.Round = 0
+	req.ExcludeIds = nil
+
+	resp, err = s.locationClient.Nearest(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Locations, nil
+}
+
+// RideNoDrivers is published to the ride_events exchange with
+// the ride.no_drivers routing key when the dispatcher gives up on the ride
+type RideNoDrivers struct {
+	RideID   uint
+	Attempts int // searches without drivers
+	Rounds   int // rounds of offers nobody accepted
+	Radius   float64
+	At       time.Time
+}
+
+// headerInt reads the integer header, amqp decodes them as different int types
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// withHeader copies the headers with the integer header set to the value
+func withHeader(headers amqp.Table, key string, value int) amqp.Table {
+	h := amqp.Table{}
+	for k, v := range headers {
+		h[k] = v
+	}
+	h[key] = int32(value)
+
+	return h
+}
+
+// retryLater puts the ride to the open_ride_delay queue,
+// it goes back to open_ride_queue after the retry delay
+func (s *dispatcherService) retryLater(d amqp.Delivery, attempts int) error {
+	return s.ch.Publish(
+		"",
+		"open_ride_delay",
+		false,
+		false,
+		amqp.Publishing{
+			Headers:      withHeader(d.Headers, attemptsHeader, attempts),
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Expiration:   fmt.Sprintf("%d", s.search.RetryDelay.Milliseconds()),
+			Body:         d.Body,
+		})
+}
+
+// publishNoDrivers tells the trip management service no driver took the ride,
+// radius is the one of the last search
+func (s *dispatcherService) publishNoDrivers(ride Ride, attempts, rounds int, radius float64) error {
+	data, err := json.Marshal(RideNoDrivers{
+		RideID:   ride.ID,
+		Attempts: attempts,
+		Rounds:   rounds,
+		Radius:   radius,
+		At:       time.Now().UTC(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return s.ch.Publish(
+		"ride_events",
+		"ride.no_drivers",
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Body:         data,
+		})
+}
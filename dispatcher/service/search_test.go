@@ -0,0 +1,64 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestSearchRadius(t *testing.T) {
+	tests := []struct {
+		radii    []float64
+		attempts int
+		want     float64
+	}{
+		{[]float64{5}, 0, 5},
+		{[]float64{5}, 3, 5},
+		{[]float64{1, 3, 5}, 0, 1},
+		{[]float64{1, 3, 5}, 1, 3},
+		{[]float64{1, 3, 5}, 2, 5},
+		// the last radius after the steps
+		{[]float64{1, 3, 5}, 9, 5},
+	}
+
+	for _, tt := range tests {
+		if got := (SearchConfig{Radii: tt.radii}).radius(tt.attempts); got != tt.want {
+			t.Errorf("radius(%v, %d) = %v, want %v", tt.radii, tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderInt(t *testing.T) {
+	tests := []struct {
+		headers amqp.Table
+		want    int
+	}{
+		{nil, 0},
+		{amqp.Table{attemptsHeader: 3}, 3},
+		{amqp.Table{attemptsHeader: int32(4)}, 4},
+		{amqp.Table{attemptsHeader: int64(5)}, 5},
+		{amqp.Table{attemptsHeader: "6"}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := headerInt(tt.headers, attemptsHeader); got != tt.want {
+			t.Errorf("headerInt(%v) = %d, want %d", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestWithHeader(t *testing.T) {
+	headers := amqp.Table{"x-death": []interface{}{}, attemptsHeader: int32(1)}
+
+	got := withHeader(headers, roundsHeader, 2)
+	want := amqp.Table{"x-death": []interface{}{}, attemptsHeader: int32(1), roundsHeader: int32(2)}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withHeader = %v, want %v", got, want)
+	}
+
+	if _, ok := headers[roundsHeader]; ok {
+		t.Errorf("withHeader changed the headers of the message %v", headers)
+	}
+}
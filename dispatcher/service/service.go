@@ -8,8 +8,12 @@ import (
 	"github.com/go-kit/kit/log"
 	dClient "github.com/jadilet/taximicroservice/drivermanagement/pb"
 	"github.com/jadilet/taximicroservice/location/pb"
+	"github.com/jadilet/taximicroservice/pkg/cancelled"
+	"github.com/jadilet/taximicroservice/pkg/queues"
 
 	"github.com/streadway/amqp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Ride struct {
@@ -23,6 +27,12 @@ type Ride struct {
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	SentAt      time.Time
+	// VehicleClass is the class of the vehicle the passenger asked for, any class when empty
+	VehicleClass string
+	// set by the dispatcher, kept while the ride goes around the queues
+	Offered         []int32       // drivers the ride was offered to
+	Round           int           // dispatch rounds so far
+	ResponseTimeout time.Duration // how long the drivers have to accept
 }
 
 type DispatcherService interface {
@@ -34,12 +44,17 @@ type dispatcherService struct {
 	ch             *amqp.Channel
 	locationClient pb.LocationClient
 	driverClient   dClient.DriverClient
-	radius         float64
+	search         SearchConfig
+	strategy       OfferStrategy
+	windows        []ResponseWindow
+	cancelled      cancelled.Rides
 }
 
 func NewDispatcherService(log log.Logger, ch *amqp.Channel,
-	locationClient pb.LocationClient, driverClient dClient.DriverClient, radius float64) DispatcherService {
-	return &dispatcherService{log, ch, locationClient, driverClient, radius}
+	locationClient pb.LocationClient, driverClient dClient.DriverClient, search SearchConfig,
+	strategy OfferStrategy, windows []ResponseWindow, cancelledRides cancelled.Rides) DispatcherService {
+	return &dispatcherService{log, ch, locationClient, driverClient, search, strategy, windows,
+		cancelledRides}
 }
 
 func (s *dispatcherService) Dispatch(ctx context.Context) error {
@@ -69,75 +84,91 @@ func (s *dispatcherService) Dispatch(ctx context.Context) error {
 
 			if err != nil {
 				s.logger.Log("Failed parse ride message body", err)
-				if err := d.Nack(false, true); err != nil {
-					s.logger.Log("Error negative acknowledging ride", err)
-				}
+				s.reject(d)
 				continue
 			}
 
-			s.logger.Log("Dispatcher processing the ride ", ride.ID, ride.Addr)
-
-			resp, err := s.locationClient.Nearest(ctx, &pb.GeoRequest{Lat: ride.Lat,
-				Lon: ride.Lon, Radius: s.radius})
+			isCancelled, err := s.cancelled.Has(ctx, ride.ID)
 
 			if err != nil {
-				s.logger.Log("Error grcp call Nearest: ", err)
-				if err := d.Nack(false, true); err != nil {
-					s.logger.Log("Error negative acknowledging the ride", err)
+				s.logger.Log("Error reading the cancelled rides RideID=", ride.ID, "err", err)
+				s.retry(d, "open_ride_queue")
+				continue
+			}
+
+			if isCancelled {
+				if err := d.Ack(false); err != nil {
+					s.logger.Log("Error ackowledging ride", err)
 				}
+				s.logger.Log("Cancelled ride dropped RideID=", ride.ID)
 				continue
 			}
 
-			if len(resp.Locations) != 0 {
-				count := 0
-				for _, driver := range resp.Locations {
-					_, err := s.driverClient.Send(ctx, &dClient.Request{Driverid: driver.Id,
-						Dist: driver.Dist,
-						Lat:  ride.Lat,
-						Lon:  ride.Lon,
-					})
+			// the empty searches widen the radius, the rounds nobody accepted
+			// have their own limit so the declined offers don't widen it
+			attempts := headerInt(d.Headers, attemptsHeader)
+			rounds := headerInt(d.Headers, roundsHeader)
+			radius := s.search.radius(attempts)
 
-					if err != nil {
-						count++
-						s.logger.Log("Can't send ride to driver:", driver.Name, " ride ID", ride.ID,
-							"err", err)
-					}
-				}
+			if rounds >= s.search.MaxRounds {
+				s.giveUp(d, ride, attempts, rounds, radius)
+				continue
+			}
+
+			s.logger.Log("Dispatcher processing the ride ", ride.ID, ride.Addr, "radius", radius)
+
+			locations, err := s.nearest(ctx, &ride, radius)
 
-				// if doesn't send any driver then set negative acknowledge about the ride
-				if len(resp.Locations) == count {
-					if err := d.Nack(false, true); err != nil {
-						s.logger.Log("Error negative acknowledging the ride", err)
-					}
+			if err != nil {
+				s.logger.Log("Error grcp call Nearest: ", err)
+
+				// the ride location is invalid, retrying doesn't help
+				if status.Code(err) == codes.InvalidArgument {
+					s.reject(d)
 					continue
 				}
 
+				s.retry(d, "open_ride_queue")
+				continue
+			}
+
+			timeout := s.responseTimeout(ride)
+			sent, err := s.offer(ctx, &ride, locations, timeout)
+
+			// if doesn't send any driver then set negative acknowledge about the ride
+			if err != nil {
+				s.retry(d, "open_ride_queue")
+				continue
+			}
+
+			if sent != 0 {
+				ride.Round++
+				ride.ResponseTimeout = timeout
 				ride.SentAt = time.Now()
 				data, err := json.Marshal(&ride)
 
 				if err != nil {
 					s.logger.Log("Error encoding ride to json ", err)
-					if err := d.Nack(false, true); err != nil {
-						s.logger.Log("Error negative acknowledging the ride", err)
-					}
+					s.retry(d, "open_ride_queue")
 					continue
 				}
 
+				// the ride reaches waiting_driver_response when the response timeout expires,
+				// it comes back here with one more round when nobody accepts it
 				err = s.ch.Publish(
 					"",
-					"waiting_driver_response",
+					ResponseQueue(timeout),
 					false,
 					false,
 					amqp.Publishing{
+						Headers:      withHeader(d.Headers, roundsHeader, rounds+1),
 						DeliveryMode: amqp.Persistent,
 						ContentType:  "application/json",
 						Body:         data,
 					})
 				if err != nil {
-					s.logger.Log("Error to write a ride to the waiting_driver_response channel ", ride.ID)
-					if err := d.Nack(false, true); err != nil {
-						s.logger.Log("Error negative acknowledging the ride", err)
-					}
+					s.logger.Log("Error to write a ride to the", ResponseQueue(timeout), "channel ", ride.ID)
+					s.retry(d, "open_ride_queue")
 					continue
 				}
 
@@ -148,12 +179,24 @@ func (s *dispatcherService) Dispatch(ctx context.Context) error {
 				continue
 			}
 
-			s.logger.Log("Not found drivers for trip id ", ride.ID)
-			time.Sleep(10 * time.Second)
-			if err := d.Nack(false, true); err != nil {
-				s.logger.Log("Error negative acknowledging the ride", err)
+			// no driver around or none of them can take the ride
+			attempts++
+			s.logger.Log("Not found drivers for trip id ", ride.ID, "attempt", attempts, "radius", radius)
+
+			if attempts >= s.search.MaxAttempts {
+				s.giveUp(d, ride, attempts, rounds, radius)
+				continue
 			}
 
+			if err := s.retryLater(d, attempts); err != nil {
+				s.logger.Log("Error to write a ride to the open_ride_delay queue ", ride.ID, "err", err)
+				s.retry(d, "open_ride_queue")
+				continue
+			}
+
+			if err := d.Ack(false); err != nil {
+				s.logger.Log("Error ackowledging ride", err)
+			}
 		}
 	}()
 
@@ -162,3 +205,77 @@ func (s *dispatcherService) Dispatch(ctx context.Context) error {
 
 	return nil
 }
+
+// giveUp tells the trip management service no driver took the ride
+func (s *dispatcherService) giveUp(d amqp.Delivery, ride Ride, attempts, rounds int, radius float64) {
+	if err := s.publishNoDrivers(ride, attempts, rounds, radius); err != nil {
+		s.logger.Log("Error publishing no drivers available RideID", ride.ID, "err", err)
+		s.retry(d, "open_ride_queue")
+		return
+	}
+
+	if err := d.Ack(false); err != nil {
+		s.logger.Log("Error ackowledging ride", err)
+	}
+	s.logger.Log("No drivers available, ride dropped RideID=", ride.ID, "attempts", attempts, "rounds", rounds)
+}
+
+// offer sends the ride to the drivers the strategy picks, the drivers who
+// can't take the ride are skipped for the next ones, it fails when no driver
+// got the offer because of the errors the driver management service may recover from
+func (s *dispatcherService) offer(ctx context.Context, ride *Ride, locations []*pb.GeoLocation,
+	timeout time.Duration) (int, error) {
+	sent := 0
+	var lastErr error
+
+	for len(locations) != 0 {
+		for _, driver := range s.strategy.Next(*ride, locations) {
+			_, err := s.driverClient.Send(ctx, &dClient.Request{Rideid: int32(ride.ID),
+				Driverid: driver.Id,
+				Dist:     driver.Dist,
+				Lat:      ride.Lat,
+				Lon:      ride.Lon,
+				Timeout:  int32(timeout.Seconds()),
+			})
+
+			switch status.Code(err) {
+			case codes.OK:
+				sent++
+			case codes.NotFound, codes.FailedPrecondition, codes.InvalidArgument:
+				// the driver is unknown, blocked or busy, keep them out of the next rounds
+				s.logger.Log("Driver can't take the ride DriverID=", driver.Id, " ride ID", ride.ID,
+					"err", err)
+			default:
+				lastErr = err
+				s.logger.Log("Can't send ride to driver:", driver.Name, " ride ID", ride.ID,
+					"err", err)
+				continue
+			}
+
+			ride.Offered = append(ride.Offered, driver.Id)
+		}
+
+		if sent != 0 || lastErr != nil {
+			break
+		}
+
+		// every picked driver refused, try the next ones
+		locations = notOffered(*ride, locations)
+	}
+
+	if sent == 0 && lastErr != nil {
+		return 0, lastErr
+	}
+
+	return sent, nil
+}
+
+// retry puts the message to the next delay queue, see queues.Retry
+func (s *dispatcherService) retry(d amqp.Delivery, queue string) {
+	queues.Retry(s.ch, d, queue, s.logger)
+}
+
+// reject parks the poison message in the dead letter queue
+func (s *dispatcherService) reject(d amqp.Delivery) {
+	queues.Reject(d, s.logger)
+}
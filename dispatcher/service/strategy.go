@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jadilet/taximicroservice/location/pb"
+)
+
+// OfferStrategy picks the drivers the ride is offered to in a dispatch round
+type OfferStrategy interface {
+	// Next returns the drivers to offer the ride to,
+	// drivers are sorted by distance ASC
+	Next(ride Ride, drivers []*pb.GeoLocation) []*pb.GeoLocation
+	// Timeout is how long the drivers have to accept the offer
+	Timeout() time.Duration
+}
+
+// NewOfferStrategy returns the strategy by name: broadcast, sequential or batched
+func NewOfferStrategy(name string, timeout time.Duration, batchSize int) (OfferStrategy, error) {
+	switch name {
+	case "", "broadcast":
+		return broadcast{timeout}, nil
+	case "sequential":
+		return sequential{timeout}, nil
+	case "batched":
+		if batchSize < 1 {
+			return nil, fmt.Errorf("batch size must be positive got %d", batchSize)
+		}
+		return batched{timeout, batchSize}, nil
+	default:
+		return nil, fmt.Errorf("unknown offer strategy %q", name)
+	}
+}
+
+// broadcast offers the ride to every driver at the same time
+type broadcast struct {
+	timeout time.Duration
+}
+
+func (b broadcast) Next(ride Ride, drivers []*pb.GeoLocation) []*pb.GeoLocation {
+	return drivers
+}
+
+func (b broadcast) Timeout() time.Duration {
+	return b.timeout
+}
+
+// sequential offers the ride to the nearest driver who hasn't seen it yet
+type sequential struct {
+	timeout time.Duration
+}
+
+func (s sequential) Next(ride Ride, drivers []*pb.GeoLocation) []*pb.GeoLocation {
+	candidates := notOffered(ride, drivers)
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	return candidates[:1]
+}
+
+func (s sequential) Timeout() time.Duration {
+	return s.timeout
+}
+
+// batched offers the ride to the nearest size drivers,
+// every next round the batch grows by size
+type batched struct {
+	timeout time.Duration
+	size    int
+}
+
+func (b batched) Next(ride Ride, drivers []*pb.GeoLocation) []*pb.GeoLocation {
+	candidates := notOffered(ride, drivers)
+	n := b.size * (ride.Round + 1)
+
+	if len(candidates) > n {
+		return candidates[:n]
+	}
+
+	return candidates
+}
+
+func (b batched) Timeout() time.Duration {
+	return b.timeout
+}
+
+// notOffered filters out the drivers the ride was already offered to
+func notOffered(ride Ride, drivers []*pb.GeoLocation) []*pb.GeoLocation {
+	offered := make(map[int32]bool, len(ride.Offered))
+	for _, id := range ride.Offered {
+		offered[id] = true
+	}
+
+	res := []*pb.GeoLocation{}
+	for _, driver := range drivers {
+		if !offered[driver.Id] {
+			res = append(res, driver)
+		}
+	}
+
+	return res
+}
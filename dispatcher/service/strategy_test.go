@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	dClient "github.com/jadilet/taximicroservice/drivermanagement/pb"
+	"github.com/jadilet/taximicroservice/location/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// drivers returns the locations of the drivers by distance ASC
+func drivers(ids ...int32) []*pb.GeoLocation {
+	res := []*pb.GeoLocation{}
+	for i, id := range ids {
+		res = append(res, &pb.GeoLocation{Id: id, Dist: float64(i)})
+	}
+
+	return res
+}
+
+func ids(drivers []*pb.GeoLocation) []int32 {
+	res := []int32{}
+	for _, d := range drivers {
+		res = append(res, d.Id)
+	}
+
+	return res
+}
+
+func TestNewOfferStrategy(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+		want      OfferStrategy
+		wantErr   bool
+	}{
+		{"", 3, broadcast{time.Second}, false},
+		{"broadcast", 3, broadcast{time.Second}, false},
+		{"sequential", 3, sequential{time.Second}, false},
+		{"batched", 3, batched{time.Second, 3}, false},
+		{"batched", 0, nil, true},
+		{"random", 3, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := NewOfferStrategy(tt.name, time.Second, tt.batchSize)
+
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NewOfferStrategy(%q, %d) = %v, %v, want %v, error %v",
+				tt.name, tt.batchSize, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestOfferStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy OfferStrategy
+		ride     Ride
+		drivers  []*pb.GeoLocation
+		want     []int32
+	}{
+		{"broadcast", broadcast{}, Ride{}, drivers(1, 2, 3), []int32{1, 2, 3}},
+		{"broadcast nobody", broadcast{}, Ride{}, drivers(), []int32{}},
+		{"sequential first round", sequential{}, Ride{}, drivers(1, 2, 3), []int32{1}},
+		{"sequential next round", sequential{}, Ride{Offered: []int32{1}, Round: 1}, drivers(1, 2, 3),
+			[]int32{2}},
+		{"sequential everybody offered", sequential{}, Ride{Offered: []int32{1, 2}, Round: 2}, drivers(1, 2),
+			[]int32{}},
+		{"batched first round", batched{size: 2}, Ride{}, drivers(1, 2, 3, 4, 5, 6, 7), []int32{1, 2}},
+		{"batched grows", batched{size: 2}, Ride{Offered: []int32{1, 2}, Round: 1}, drivers(1, 2, 3, 4, 5, 6, 7),
+			[]int32{3, 4, 5, 6}},
+		{"batched fewer drivers", batched{size: 2}, Ride{Offered: []int32{1}, Round: 1}, drivers(1, 2, 3),
+			[]int32{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(tt.strategy.Next(tt.ride, tt.drivers)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Next(%+v) = %v, want %v", tt.ride, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeDriverClient answers Send with the error of the driver
+type fakeDriverClient struct {
+	errs map[int32]error
+}
+
+func (c *fakeDriverClient) Send(ctx context.Context, in *dClient.Request,
+	opts ...grpc.CallOption) (*dClient.Response, error) {
+	return &dClient.Response{}, c.errs[in.Driverid]
+}
+
+func TestOffer(t *testing.T) {
+	busy := status.Error(codes.FailedPrecondition, "driver is busy")
+	down := status.Error(codes.Unavailable, "connection refused")
+
+	tests := []struct {
+		name        string
+		strategy    OfferStrategy
+		errs        map[int32]error
+		wantSent    int
+		wantOffered []int32
+		wantErr     error
+	}{
+		{"broadcast", broadcast{}, nil, 3, []int32{1, 2, 3}, nil},
+		{"broadcast busy driver", broadcast{}, map[int32]error{2: busy}, 2, []int32{1, 2, 3}, nil},
+		// the refusing drivers are skipped for the next one
+		{"sequential busy drivers", sequential{}, map[int32]error{1: busy, 2: busy}, 1, []int32{1, 2, 3}, nil},
+		{"sequential everybody busy", sequential{}, map[int32]error{1: busy, 2: busy, 3: busy}, 0,
+			[]int32{1, 2, 3}, nil},
+		// the driver may get the offer in the next round
+		{"sequential unavailable", sequential{}, map[int32]error{1: down}, 0, []int32{}, down},
+		{"broadcast partly unavailable", broadcast{}, map[int32]error{1: down}, 2, []int32{2, 3}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDriverClient{errs: tt.errs}
+			s := &dispatcherService{logger: log.NewNopLogger(), driverClient: client, strategy: tt.strategy}
+			ride := Ride{ID: 7}
+
+			sent, err := s.offer(context.Background(), &ride, drivers(1, 2, 3), time.Second)
+
+			if !errors.Is(err, tt.wantErr) || sent != tt.wantSent {
+				t.Errorf("offer = %d, %v, want %d, %v", sent, err, tt.wantSent, tt.wantErr)
+			}
+
+			if got := append([]int32{}, ride.Offered...); !reflect.DeepEqual(got, tt.wantOffered) {
+				t.Errorf("offered %v, want %v", got, tt.wantOffered)
+			}
+		})
+	}
+}
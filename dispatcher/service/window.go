@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// ResponseWindow overrides how long the drivers have
+// to accept the rides starting inside the region
+type ResponseWindow struct {
+	Name    string  `json:"name"`
+	MinLat  float64 `json:"min_lat"`
+	MinLon  float64 `json:"min_lon"`
+	MaxLat  float64 `json:"max_lat"`
+	MaxLon  float64 `json:"max_lon"`
+	Timeout int     `json:"timeout"` // seconds
+}
+
+func (w ResponseWindow) contains(lat, lon float64) bool {
+	return lat >= w.MinLat && lat <= w.MaxLat && lon >= w.MinLon && lon <= w.MaxLon
+}
+
+// ResponseQueue is the delay queue the ride waits in for the driver response,
+// expired rides go to waiting_driver_response
+func ResponseQueue(timeout time.Duration) string {
+	return fmt.Sprintf("waiting_driver_response.delay.%s", timeout)
+}
+
+// DeclareResponseQueues declares a delay queue per response timeout,
+// every timeout has its own queue so the rides expire in order
+func DeclareResponseQueues(ch *amqp.Channel, timeouts []time.Duration) error {
+	for _, timeout := range timeouts {
+		_, err := ch.QueueDeclare(
+			ResponseQueue(timeout), // name
+			true,                   // durable
+			false,                  // delete when unused
+			false,                  // exclusive
+			false,                  // no-wait
+			amqp.Table{
+				"x-message-ttl":             int32(timeout.Milliseconds()),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": "waiting_driver_response",
+			},
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// responseTimeout is the window of the region the ride starts in,
+// the offer strategy timeout otherwise
+func (s *dispatcherService) responseTimeout(ride Ride) time.Duration {
+	for _, w := range s.windows {
+		if w.contains(ride.Lat, ride.Lon) {
+			return time.Duration(w.Timeout) * time.Second
+		}
+	}
+
+	return s.strategy.Timeout()
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseTimeout(t *testing.T) {
+	s := &dispatcherService{strategy: broadcast{15 * time.Second}, windows: []ResponseWindow{
+		{Name: "airport", MinLat: 43.34, MinLon: 77.0, MaxLat: 43.36, MaxLon: 77.05, Timeout: 30},
+		{Name: "center", MinLat: 43.2, MinLon: 76.9, MaxLat: 43.3, MaxLon: 77.0, Timeout: 20},
+	}}
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     time.Duration
+	}{
+		{"airport", 43.35, 77.03, 30 * time.Second},
+		{"center", 43.25, 76.95, 20 * time.Second},
+		{"edge of the region", 43.34, 77.0, 30 * time.Second},
+		{"outside", 43.1, 76.8, 15 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := s.responseTimeout(Ride{Lat: tt.lat, Lon: tt.lon}); got != tt.want {
+			t.Errorf("responseTimeout(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
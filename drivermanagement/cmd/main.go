@@ -18,6 +18,10 @@ import (
 	"github.com/jadilet/taximicroservice/drivermanagement/service"
 	"github.com/jadilet/taximicroservice/drivermanagement/transports"
 	location "github.com/jadilet/taximicroservice/location/pb"
+	"github.com/jadilet/taximicroservice/pkg/auth"
+	"github.com/jadilet/taximicroservice/pkg/cancelled"
+	"github.com/jadilet/taximicroservice/pkg/mtls"
+	"github.com/jadilet/taximicroservice/pkg/queues"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
@@ -27,6 +31,10 @@ import (
 	"gorm.io/gorm"
 )
 
+// cancelledTTL is how long the cancelled rides are remembered,
+// the rides older than an hour are dropped anyway
+const cancelledTTL = 2 * time.Hour
+
 func main() {
 	var (
 		httpAddr = flag.String("http.addr", ":8081", "HTTP listen address")
@@ -77,6 +85,8 @@ func main() {
 	// then offers the ride to the drivers
 	// waits for the driver's response
 	// if driver doesn't accept the ride then the ride would be re-queued to the dispatcher service
+	// rejected rides are parked in waiting_driver_response.dlq by the rides.dlx exchange,
+	// the rides-dlx policy sets it, see dispatcher/deployments/rabbitmq
 	_, err = ch.QueueDeclare(
 		"waiting_driver_response", // name
 		true,                      // durable
@@ -91,6 +101,79 @@ func main() {
 		return
 	}
 
+	err = queues.DeclareDeadLetterQueue(ch, "waiting_driver_response")
+
+	if err != nil {
+		logger.Log("Failed to declare a dead letter queue of waiting_driver_response", err)
+		return
+	}
+
+	err = queues.DeclareRetryQueues(ch, "waiting_driver_response")
+
+	if err != nil {
+		logger.Log("Failed to declare the retry queues of waiting_driver_response", err)
+		return
+	}
+
+	// ride_events: ride status changes published by the services
+	// e.g. ride.cancelled when the passenger cancels the ride
+	err = ch.ExchangeDeclare(
+		"ride_events", // name
+		"topic",       // type
+		true,          // durable
+		false,         // auto-deleted
+		false,         // internal
+		false,         // no-wait
+		nil,           // arguments
+	)
+
+	if err != nil {
+		logger.Log("Failed to declare an exchange ride_events", err)
+		return
+	}
+
+	// driver_offers: the offers are routed by driver.<id> to the replicas
+	// the driver apps are connected to
+	err = ch.ExchangeDeclare(
+		"driver_offers", // name
+		"direct",        // type
+		true,            // durable
+		false,           // auto-deleted
+		false,           // internal
+		false,           // no-wait
+		nil,             // arguments
+	)
+
+	if err != nil {
+		logger.Log("Failed to declare an exchange driver_offers", err)
+		return
+	}
+
+	// driver_ride_finished: the drivers of the completed or cancelled rides
+	// are available again
+	_, err = ch.QueueDeclare(
+		"driver_ride_finished", // name
+		true,                   // durable
+		false,                  // delete when unused
+		false,                  // exclusive
+		false,                  // no-wait
+		nil,                    // arguments
+	)
+
+	if err != nil {
+		logger.Log("Failed to declare a queue driver_ride_finished", err)
+		return
+	}
+
+	for _, key := range []string{"ride.completed", "ride.cancelled"} {
+		err = ch.QueueBind("driver_ride_finished", key, "ride_events", false, nil)
+
+		if err != nil {
+			logger.Log("Failed to bind the queue driver_ride_finished", key, err)
+			return
+		}
+	}
+
 	err = ch.Qos(
 		1,     // prefetch count
 		0,     // prefetch size
@@ -112,7 +195,7 @@ func main() {
 		os.Getenv("MYSQL_DBNAME"),
 	)
 
-	masterDb, err := dbConnection(dnsMaster, 15, 100, true)
+	masterDb, err := dbConnection(logger, dnsMaster, 15, 100, true)
 
 	if err != nil {
 		logger.Log("Master database ", err)
@@ -129,15 +212,29 @@ func main() {
 		os.Getenv("MYSQL_DBNAME"),
 	)
 
-	slaveDb, err := dbConnection(dnsSlave, 15, 100, false)
+	slaveDb, err := dbConnection(logger, dnsSlave, 15, 100, false)
 
 	if err != nil {
 		logger.Log("Slave database ", err)
 		return
 	}
 
+	// GRPC_TLS_CERT_FILE, GRPC_TLS_KEY_FILE, GRPC_TLS_CA_FILE: see mtls.FromEnv,
+	// the certificate of drivermanagement lets it write the locations,
+	// with mTLS only the dispatcher sends the rides to the drivers
+	tlsConfig, err := mtls.FromEnv()
+
+	if err != nil {
+		logger.Log("Failed to load the gRPC TLS configuration", err)
+		return
+	}
+
+	if !tlsConfig.Mutual() {
+		level.Warn(logger).Log("msg", "gRPC callers aren't authenticated, mTLS isn't configured")
+	}
+
 	// Grpc client of LocationService
-	var opts []grpc.DialOption = []grpc.DialOption{grpc.WithInsecure()}
+	var opts []grpc.DialOption = []grpc.DialOption{tlsConfig.DialOption()}
 	addr := fmt.Sprintf("%s:%s",
 		os.Getenv("GRPC_LOCATION_SRV_NAME"),
 		os.Getenv("GRPC_LOCATION_SRV_PORT"))
@@ -152,8 +249,72 @@ func main() {
 
 	locationClient := location.NewLocationClient(grpcLocationSrvConn)
 
-	s := service.NewDriverService(logger, masterDb, slaveDb, ch, locationClient)
-	h := transports.MakeHTTPHandler(s, log.With(logger, "component", "HTTP"))
+	// AUTH_PUBLIC_KEY_FILE, AUTH_PRIVATE_KEY_FILE: PEM RSA keys of the RS256 tokens,
+	// the driver management service issues the driver tokens so it needs both
+	// AUTH_KEY_FILE: shared HS256 secret instead of the RSA keys for local runs and tests,
+	// pkg/auth/cmd/token writes one and issues tokens of any role with it
+	keys, err := auth.LoadKeys()
+
+	if err != nil {
+		logger.Log("Failed to load the auth keys", err)
+		return
+	}
+
+	// REDIS_CLUSTER_ADDRS or REDIS_HOST, REDIS_PORT, REDIS_DB, REDIS_USER, REDIS_PASSWORD:
+	// the redis of the cancelled rides, see cancelled.FromEnv
+	cancelledRides, err := cancelled.FromEnv(cancelledTTL)
+
+	if err != nil {
+		logger.Log("Failed to connect the cancelled rides redis", err)
+		return
+	}
+
+	if !cancelledRides.Shared() {
+		level.Warn(logger).Log("msg", "the replicas don't share the cancelled rides, redis isn't configured")
+	}
+
+	s := service.NewDriverService(logger, masterDb, slaveDb, ch, locationClient, cancelledRides)
+	h := transports.MakeHTTPHandler(s, keys, log.With(logger, "component", "HTTP"))
+
+	err = cancelled.Watch(context.Background(), ch, cancelledRides, "driver_ride_cancelled", logger)
+
+	if err != nil {
+		logger.Log("Error WatchCancellations function", err)
+		return
+	}
+
+	err = s.ConsumeOffers(context.Background())
+
+	if err != nil {
+		logger.Log("Error ConsumeOffers function", err)
+		return
+	}
+
+	go func(s service.DriverService) {
+		err := s.StreamLocations(context.Background())
+
+		if err != nil {
+			logger.Log("Error StreamLocations function", err)
+		}
+	}(s)
+
+	go func(s service.DriverService) {
+		err := s.ConsumeRideFinished(context.Background())
+
+		if err != nil {
+			logger.Log("Error ConsumeRideFinished function", err)
+		}
+	}(s)
+
+	// the drivers whose offers expired without a response check are released,
+	// every replica sweeps
+	go func(s service.DriverService) {
+		err := s.SweepOffers(context.Background())
+
+		if err != nil {
+			logger.Log("Error SweepOffers function", err)
+		}
+	}(s)
 
 	go func(s service.DriverService) {
 		err = s.CheckResponse(context.Background())
@@ -175,7 +336,9 @@ func main() {
 	}
 
 	go func() {
-		baseServer := grpc.NewServer()
+		baseServer := grpc.NewServer(tlsConfig.ServerOptions(mtls.Rules{
+			"/pb.Driver/Send": {"dispatcher"},
+		})...)
 		reflection.Register(baseServer)
 		pb.RegisterDriverServer(baseServer, grpcServer)
 		level.Info(logger).Log("msg", "Driver Management GRPC Server started successfully", "port",
@@ -206,7 +369,8 @@ func main() {
 	logger.Log("exit", <-errs)
 }
 
-func dbConnection(dns string, maxIdleConns, maxOpenConns int, isMaster bool) (*gorm.DB, error) {
+func dbConnection(logger log.Logger, dns string, maxIdleConns, maxOpenConns int,
+	isMaster bool) (*gorm.DB, error) {
 	db, err := gorm.Open(mysql.Open(dns), &gorm.Config{})
 
 	if err != nil {
@@ -214,13 +378,7 @@ func dbConnection(dns string, maxIdleConns, maxOpenConns int, isMaster bool) (*g
 	}
 
 	if isMaster {
-		err = db.AutoMigrate(&service.Driver{})
-
-		if err != nil {
-			return nil, err
-		}
-
-		err = db.AutoMigrate(&service.Task{})
+		err = service.Migrate(db, logger)
 
 		if err != nil {
 			return nil, err
@@ -2,40 +2,108 @@ package endpoints
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/jadilet/taximicroservice/drivermanagement/service"
+	"github.com/jadilet/taximicroservice/pkg/auth"
 )
 
 type EndpointHttp struct {
 	Register endpoint.Endpoint
 	Accept   endpoint.Endpoint
 	Set      endpoint.Endpoint
+	AckOffer endpoint.Endpoint
+	Online   endpoint.Endpoint
+	Offline  endpoint.Endpoint
+	Login    endpoint.Endpoint
+	Refresh  endpoint.Endpoint
+	Get      endpoint.Endpoint
+	List     endpoint.Endpoint
+	Update   endpoint.Endpoint
+	Block    endpoint.Endpoint
+	Unblock  endpoint.Endpoint
 }
 
 type EndpointGrpc struct {
 	Send endpoint.Endpoint
 }
 
+// DriverRegisterReq has the fields a driver sets on registration,
+// the others e.g. the ID, the status and Blocked are set by the service
 type DriverRegisterReq struct {
-	Driver service.Driver
+	Name         string `validate:"required,max=100"`
+	Email        string `validate:"required,email,max=254"`
+	Telephone    string `validate:"required,e164"`
+	VehicleClass string `validate:"omitempty,alphanum,max=32"`
+	Password     string `validate:"required,min=8,max=72"` // bcrypt reads 72 bytes at most
+}
+
+type LoginReq struct {
+	Email    string `validate:"required,email"`
+	Password string `validate:"required"`
+}
+
+type RefreshReq struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResp struct {
+	auth.Tokens
+	Err error `json:"error,omitempty"`
 }
 
 type DriverAcceptReq struct {
-	Task service.Task
+	RideID uint `validate:"required"`
 }
 
 type RideReq struct {
+	RideID   uint
 	DriverID uint
 	Dist     float64
 	Lat      float64
 	Lon      float64
+	Timeout  time.Duration
 }
 
-type LocReq struct {
+type DriverIDReq struct {
 	DriverID uint
-	Lat      float64
-	Lon      float64
+}
+
+type ListReq struct {
+	Filter service.DriverFilter
+}
+
+type UpdateReq struct {
+	DriverID     uint   `json:"-"`
+	Name         string `validate:"required,max=100"`
+	Email        string `validate:"required,email,max=254"`
+	Telephone    string `validate:"required,e164"`
+	VehicleClass string `validate:"omitempty,alphanum,max=32"`
+}
+
+type BlockReq struct {
+	DriverID uint   `json:"-"`
+	Reason   string `validate:"required,max=255"`
+}
+
+type GetResp struct {
+	Driver service.Driver `json:"driver"`
+	Err    error          `json:"error,omitempty"`
+}
+
+type ListResp struct {
+	service.DriverPage
+	Err error `json:"error,omitempty"`
+}
+
+type AckOfferReq struct {
+	OfferID uint
+}
+
+type LocReq struct {
+	Lat float64 `validate:"latitude"`
+	Lon float64 `validate:"longitude"`
 }
 
 type LocResp struct {
@@ -54,7 +122,13 @@ type DriverResp struct {
 func makeSetEndpoint(s service.DriverLocationService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(LocReq)
-		err = s.Set(ctx, req.DriverID, req.Lat, req.Lon)
+		driverID, err := auth.Subject(ctx)
+
+		if err != nil {
+			return LocResp{Err: err}, err
+		}
+
+		err = s.Set(ctx, driverID, req.Lat, req.Lon)
 
 		return LocResp{Err: err}, err
 	}
@@ -63,7 +137,12 @@ func makeSetEndpoint(s service.DriverLocationService) endpoint.Endpoint {
 func makeRegisterEndpoint(s service.DriverService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(DriverRegisterReq)
-		msg, err := s.Register(ctx, req.Driver)
+		msg, err := s.Register(ctx, service.Driver{
+			Name:         req.Name,
+			Email:        req.Email,
+			Telephone:    req.Telephone,
+			VehicleClass: req.VehicleClass,
+		}, req.Password)
 
 		return DriverResp{Msg: msg, Err: err}, err
 	}
@@ -72,18 +151,181 @@ func makeRegisterEndpoint(s service.DriverService) endpoint.Endpoint {
 func makeAcceptEndpoint(s service.DriverService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(DriverAcceptReq)
-		msg, err := s.Accept(ctx, req.Task.DriverID, req.Task.RideID)
+		driverID, err := auth.Subject(ctx)
+
+		if err != nil {
+			return DriverResp{Err: err}, err
+		}
+
+		msg, err := s.Accept(ctx, driverID, req.RideID)
+
+		return DriverResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeAckOfferEndpoint(s service.DriverService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(AckOfferReq)
+		driverID, err := auth.Subject(ctx)
+
+		if err != nil {
+			return DriverResp{Err: err}, err
+		}
+
+		msg, err := s.AckOffer(ctx, driverID, req.OfferID)
+
+		return DriverResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeOnlineEndpoint(s service.DriverService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(DriverIDReq)
+		if err := self(ctx, req.DriverID); err != nil {
+			return DriverResp{Err: err}, err
+		}
+
+		msg, err := s.GoOnline(ctx, req.DriverID)
+
+		return DriverResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeOfflineEndpoint(s service.DriverService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(DriverIDReq)
+		if err := self(ctx, req.DriverID); err != nil {
+			return DriverResp{Err: err}, err
+		}
+
+		msg, err := s.GoOffline(ctx, req.DriverID)
+
+		return DriverResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeLoginEndpoint(s service.DriverService, keys *auth.Keys) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(LoginReq)
+		driverID, err := s.Login(ctx, req.Email, req.Password)
+
+		if err != nil {
+			return TokenResp{Err: err}, err
+		}
+
+		tokens, err := keys.Issue(driverID, auth.RoleDriver)
+
+		return TokenResp{Tokens: tokens, Err: err}, err
+	}
+}
+
+// makeRefreshEndpoint issues new tokens while the driver isn't blocked
+func makeRefreshEndpoint(s service.DriverService, keys *auth.Keys) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RefreshReq)
+		driverID, role, err := keys.Refresh(req.RefreshToken)
+
+		if err == nil && role != auth.RoleDriver {
+			err = auth.ErrForbidden
+		}
+
+		if err == nil {
+			err = s.CanLogin(ctx, driverID)
+		}
+
+		if err != nil {
+			return TokenResp{Err: err}, err
+		}
+
+		tokens, err := keys.Issue(driverID, auth.RoleDriver)
+
+		return TokenResp{Tokens: tokens, Err: err}, err
+	}
+}
+
+func makeGetEndpoint(s service.DriverService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(DriverIDReq)
+		if err := self(ctx, req.DriverID); err != nil {
+			return GetResp{Err: err}, err
+		}
+
+		driver, err := s.Get(ctx, req.DriverID)
+
+		return GetResp{Driver: driver, Err: err}, err
+	}
+}
+
+func makeListEndpoint(s service.DriverService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(ListReq)
+		page, err := s.List(ctx, req.Filter)
+
+		return ListResp{DriverPage: page, Err: err}, err
+	}
+}
+
+func makeUpdateEndpoint(s service.DriverService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(UpdateReq)
+		if err := self(ctx, req.DriverID); err != nil {
+			return GetResp{Err: err}, err
+		}
+
+		driver, err := s.Update(ctx, req.DriverID, service.DriverProfile{
+			Name:         req.Name,
+			Email:        req.Email,
+			Telephone:    req.Telephone,
+			VehicleClass: req.VehicleClass,
+		}, auth.Role(ctx) == auth.RoleAdmin)
+
+		return GetResp{Driver: driver, Err: err}, err
+	}
+}
+
+func makeBlockEndpoint(s service.DriverService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(BlockReq)
+		msg, err := s.Block(ctx, req.DriverID, req.Reason)
+
+		return DriverResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeUnblockEndpoint(s service.DriverService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(DriverIDReq)
+		msg, err := s.Unblock(ctx, req.DriverID)
 
 		return DriverResp{Msg: msg, Err: err}, err
 	}
 }
 
+// self checks the driver of the path is the driver of the token, admins act on any driver
+func self(ctx context.Context, driverID uint) error {
+	if auth.Role(ctx) == auth.RoleAdmin {
+		return nil
+	}
+
+	subject, err := auth.Subject(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if subject != driverID {
+		return auth.ErrForbidden
+	}
+
+	return nil
+}
+
 func makeSendEndpoint(s service.DriverService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(RideReq)
-		msg, err := s.Send(ctx, req.DriverID, req.Lat, req.Lon, req.Dist)
+		msg, err := s.Send(ctx, req.RideID, req.DriverID, req.Lat, req.Lon, req.Dist, req.Timeout)
 
-		return RideResp{Msg: msg, Err: err}, nil
+		return RideResp{Msg: msg, Err: err}, err
 	}
 }
 
@@ -93,10 +335,27 @@ func MakeGrpcEndpoint(s service.DriverService) EndpointGrpc {
 	}
 }
 
-func MakeHttpEndpoint(s service.DriverService) EndpointHttp {
+// MakeHttpEndpoint returns the driver app endpoints, the drivers
+// are identified by their access token except for register, login and refresh,
+// the admins list, update and block the drivers
+func MakeHttpEndpoint(s service.DriverService, keys *auth.Keys) EndpointHttp {
+	driver := keys.Middleware(auth.RoleDriver)
+	driverOrAdmin := keys.Middleware(auth.RoleDriver, auth.RoleAdmin)
+	admin := keys.Middleware(auth.RoleAdmin)
+
 	return EndpointHttp{
 		Register: makeRegisterEndpoint(s),
-		Accept:   makeAcceptEndpoint(s),
-		Set:      makeSetEndpoint(s),
+		Accept:   driver(makeAcceptEndpoint(s)),
+		Set:      driver(makeSetEndpoint(s)),
+		AckOffer: driver(makeAckOfferEndpoint(s)),
+		Online:   driver(makeOnlineEndpoint(s)),
+		Offline:  driver(makeOfflineEndpoint(s)),
+		Login:    makeLoginEndpoint(s, keys),
+		Refresh:  makeRefreshEndpoint(s, keys),
+		Get:      driverOrAdmin(makeGetEndpoint(s)),
+		List:     admin(makeListEndpoint(s)),
+		Update:   driverOrAdmin(makeUpdateEndpoint(s)),
+		Block:    admin(makeBlockEndpoint(s)),
+		Unblock:  admin(makeUnblockEndpoint(s)),
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DriverStatus is the availability of the driver,
+// only available drivers are indexed by the location service
+type DriverStatus string
+
+const (
+	DriverOffline   DriverStatus = "offline"
+	DriverAvailable DriverStatus = "available"
+	DriverOnOffer   DriverStatus = "on_offer"
+	DriverOnTrip    DriverStatus = "on_trip"
+)
+
+var (
+	ErrDriverNotFound     = errors.New("driver not found")
+	ErrDriverBlocked      = errors.New("driver is blocked")
+	ErrDriverOffline      = errors.New("driver is offline")
+	ErrDriverNotAvailable = errors.New("driver is not available")
+	ErrDriverOnTrip       = errors.New("driver is on a trip")
+)
+
+const (
+	// offerSweepInterval is the time between the sweeps of the expired offers
+	offerSweepInterval = 30 * time.Second
+	// offerGrace leaves the expired offers to CheckResponse first,
+	// the sweep only closes the offers whose ride didn't come back
+	offerGrace = time.Minute
+)
+
+// RideFinished is the part of the ride.completed and ride.cancelled
+// events the driver management service needs
+type RideFinished struct {
+	RideID uint
+}
+
+func (s *driverService) GoOnline(ctx context.Context, driverID uint) (string, error) {
+	var driver Driver
+
+	if err := s.master.First(&driver, "id = ?", driverID).Error; err != nil {
+		return "", err
+	}
+
+	if driver.Blocked {
+		return "", ErrDriverBlocked
+	}
+
+	// drivers registered before the availability model have no status
+	if err := setStatus(s.master, driverID, DriverAvailable, DriverOffline, ""); err != nil {
+		if errors.Is(err, ErrDriverNotAvailable) {
+			return fmt.Sprintf("Driver %d is %s", driverID, driver.Status), nil
+		}
+		return "", err
+	}
+
+	return fmt.Sprintf("Driver %d is available", driverID), nil
+}
+
+func (s *driverService) GoOffline(ctx context.Context, driverID uint) (string, error) {
+	var driver Driver
+
+	if err := s.master.First(&driver, "id = ?", driverID).Error; err != nil {
+		return "", err
+	}
+
+	if driver.Status == DriverOnTrip {
+		return "", ErrDriverOnTrip
+	}
+
+	if err := setStatus(s.master, driverID, DriverOffline, DriverAvailable, DriverOnOffer); err != nil {
+		if errors.Is(err, ErrDriverNotAvailable) {
+			return fmt.Sprintf("Driver %d is offline", driverID), nil
+		}
+		return "", err
+	}
+
+	if err := s.master.Model(&Offer{}).Where("driver_id = ? AND state = ?", driverID, OfferPending).
+		Update("state", OfferCancelled).Error; err != nil {
+		return "", err
+	}
+
+	if err := s.removeLocation(ctx, driverID); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Driver %d is offline", driverID), nil
+}
+
+// setStatus moves the driver to the status to when the driver is in one of the from statuses,
+// the locations read in the previous status get an earlier epoch
+func setStatus(db *gorm.DB, driverID uint, to DriverStatus, from ...DriverStatus) error {
+	res := db.Model(&Driver{}).Where("id = ? AND status IN ?", driverID, from).
+		Updates(map[string]interface{}{"status": to, "location_epoch": gorm.Expr("location_epoch + 1")})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrDriverNotAvailable
+	}
+
+	return nil
+}
+
+// released is the status of the drivers leaving an offer or a trip,
+// available unless an admin blocked them meanwhile
+func released() clause.Expr {
+	return gorm.Expr("CASE WHEN blocked THEN ? ELSE ? END", DriverOffline, DriverAvailable)
+}
+
+// releaseDrivers makes the drivers whose offers were closed available again,
+// they're indexed by the location service on the next location update
+func releaseDrivers(db *gorm.DB, driverIDs []uint) error {
+	if len(driverIDs) == 0 {
+		return nil
+	}
+
+	return db.Model(&Driver{}).Where("id IN ? AND status = ?", driverIDs, DriverOnOffer).
+		Update("status", released()).Error
+}
+
+// ConsumeRideFinished makes the driver of the completed or cancelled ride available,
+// offline when the driver was blocked during the trip,
+// the driver_ride_finished queue is shared by all the replicas
+func (s *driverService) ConsumeRideFinished(ctx context.Context) error {
+	msgs, err := s.ch.Consume(
+		"driver_ride_finished",
+		"",
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+
+	if err != nil {
+		s.logger.Log("Failed to register to driver_ride_finished a consumer", err)
+		return err
+	}
+
+	forever := make(chan bool)
+
+	go func() {
+		for d := range msgs {
+			var event RideFinished
+
+			if err := json.Unmarshal(d.Body, &event); err != nil {
+				s.logger.Log("Failed parse ride finished message body", err)
+				if err := d.Nack(false, false); err != nil {
+					s.logger.Log("Error negative acknowledging the ride", err)
+				}
+				continue
+			}
+
+			var task Task
+			err := s.master.Where("ride_id = ?", event.RideID).First(&task).Error
+
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				s.logger.Log("Error reading the task of RideID=", event.RideID, "err", err)
+				if err := d.Nack(false, true); err != nil {
+					s.logger.Log("Error negative acknowledging the ride", err)
+				}
+				continue
+			}
+
+			// there is no task when the ride was finished before a driver accepted it,
+			// the events aren't ordered so a late one mustn't release the driver
+			// from the trip they accepted after this ride
+			if err == nil {
+				err = s.master.Model(&Driver{}).
+					Where("id = ? AND status = ? AND NOT EXISTS (SELECT 1 FROM tasks WHERE driver_id = ? AND id > ?)",
+						task.DriverID, DriverOnTrip, task.DriverID, task.ID).
+					Update("status", released()).Error
+
+				if err != nil {
+					s.logger.Log("Error releasing DriverID=", task.DriverID, "err", err)
+					if err := d.Nack(false, true); err != nil {
+						s.logger.Log("Error negative acknowledging the ride", err)
+					}
+					continue
+				}
+
+				s.logger.Log("Ride finished, driver released DriverID=", task.DriverID, "RideID=", event.RideID)
+			}
+
+			if err := d.Ack(false); err != nil {
+				s.logger.Log("Error ackowledging the ride", err)
+			}
+		}
+	}()
+
+	s.logger.Log(" [*] Waiting driver_ride_finished for messages.")
+	<-forever
+
+	return nil
+}
+
+// SweepOffers releases the drivers stuck on offer until ctx is done. The drivers
+// are released when CheckResponse closes the offers of the ride, the offers of
+// the rides which never came back e.g. parked in the dead letter queue or given
+// up are expired here and their drivers released.
+func (s *driverService) SweepOffers(ctx context.Context) error {
+	ticker := time.NewTicker(offerSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		n, err := s.releaseExpiredOffers(ctx)
+
+		if err != nil {
+			s.logger.Log("Error sweeping the expired offers", err)
+			continue
+		}
+
+		if n > 0 {
+			s.logger.Log("Drivers released from expired offers", n)
+		}
+	}
+}
+
+// releaseExpiredOffers expires the pending offers past the grace and releases
+// the drivers on offer without a pending offer, it returns their count
+func (s *driverService) releaseExpiredOffers(ctx context.Context) (int64, error) {
+	var n int64
+
+	err := s.master.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Offer{}).Where("state = ? AND expires_at <= ?",
+			OfferPending, time.Now().UTC().Add(-offerGrace)).
+			Update("state", OfferExpired).Error; err != nil {
+			return err
+		}
+
+		res := tx.Model(&Driver{}).Where("status = ? AND NOT EXISTS (?)", DriverOnOffer,
+			tx.Model(&Offer{}).Select("1").Where("offers.driver_id = drivers.id AND offers.state = ?",
+				OfferPending)).
+			Update("status", released())
+
+		n = res.RowsAffected
+		return res.Error
+	})
+
+	return n, err
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrPasswordTooShort   = errors.New("password must have at least 8 characters")
+)
+
+const minPasswordLen = 8
+
+// hashPassword returns the bcrypt hash the driver logs in with
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLen {
+		return "", ErrPasswordTooShort
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Login checks the driver password and returns the driver ID
+func (s *driverService) Login(ctx context.Context, email, password string) (uint, error) {
+	var driver Driver
+
+	if err := s.slave.First(&driver, "email = ?", email).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrInvalidCredentials
+		}
+
+		return 0, err
+	}
+
+	// drivers registered before the login have no password
+	if driver.PasswordHash == "" ||
+		bcrypt.CompareHashAndPassword([]byte(driver.PasswordHash), []byte(password)) != nil {
+		return 0, ErrInvalidCredentials
+	}
+
+	if driver.Blocked {
+		return 0, ErrDriverBlocked
+	}
+
+	return driver.ID, nil
+}
+
+// CanLogin tells whether the driver may get new tokens with the refresh token
+func (s *driverService) CanLogin(ctx context.Context, driverID uint) error {
+	var driver Driver
+
+	if err := s.slave.First(&driver, "id = ?", driverID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDriverNotFound
+		}
+
+		return err
+	}
+
+	if driver.Blocked {
+		return ErrDriverBlocked
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jadilet/taximicroservice/pkg/validation"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// DriverFilter selects the drivers of a page of List, empty fields match every driver
+type DriverFilter struct {
+	Status  DriverStatus
+	Blocked *bool
+	Page    int // from 1
+	PerPage int
+}
+
+// DriverPage is a page of the drivers of the filter
+type DriverPage struct {
+	Drivers []Driver `json:"drivers"`
+	Total   int64    `json:"total"`
+	Page    int      `json:"page"`
+	PerPage int      `json:"per_page"`
+}
+
+// ErrAdminOnly is returned when a driver changes the profile fields only the admins may change
+var ErrAdminOnly = errors.New("only an admin may change the email and the vehicle class")
+
+// DriverProfile is the part of the driver which may be updated,
+// the email and the vehicle class by the admins only
+type DriverProfile struct {
+	Name         string
+	Email        string
+	Telephone    string
+	VehicleClass string
+}
+
+func (s *driverService) Get(ctx context.Context, driverID uint) (Driver, error) {
+	return findDriver(s.slave, driverID)
+}
+
+// List returns the page of the drivers of the filter ordered by ID
+func (s *driverService) List(ctx context.Context, filter DriverFilter) (DriverPage, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+
+	if filter.PerPage <= 0 || filter.PerPage > maxPerPage {
+		filter.PerPage = defaultPerPage
+	}
+
+	query := s.slave.Model(&Driver{})
+
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	if filter.Blocked != nil {
+		query = query.Where("blocked = ?", *filter.Blocked)
+	}
+
+	page := DriverPage{Drivers: []Driver{}, Page: filter.Page, PerPage: filter.PerPage}
+
+	if err := query.Count(&page.Total).Error; err != nil {
+		return DriverPage{}, err
+	}
+
+	if err := query.Order("id").Offset((filter.Page - 1) * filter.PerPage).Limit(filter.PerPage).
+		Find(&page.Drivers).Error; err != nil {
+		return DriverPage{}, err
+	}
+
+	return page, nil
+}
+
+// Update changes the profile of the driver, unless admin the email
+// and the vehicle class must stay the same
+func (s *driverService) Update(ctx context.Context, driverID uint, profile DriverProfile, admin bool) (Driver, error) {
+	driver, err := findDriver(s.master, driverID)
+
+	if err != nil {
+		return Driver{}, err
+	}
+
+	if !admin && (profile.Email != driver.Email || profile.VehicleClass != driver.VehicleClass) {
+		return Driver{}, ErrAdminOnly
+	}
+
+	if err := unique(s.master, driverID, profile.Email, profile.Telephone); err != nil {
+		return Driver{}, err
+	}
+
+	driver.Name = profile.Name
+	driver.Email = profile.Email
+	driver.Telephone = profile.Telephone
+	driver.VehicleClass = profile.VehicleClass
+
+	if err := s.master.Model(&driver).Select("Name", "Email", "Telephone", "VehicleClass").
+		Updates(&driver).Error; err != nil {
+		return Driver{}, duplicate(err)
+	}
+
+	return driver, nil
+}
+
+// Block keeps the driver from going online and getting rides, the driver leaves
+// the location index and the pending offers are cancelled so the rides are
+// dispatched again, the ride the driver is on goes on
+func (s *driverService) Block(ctx context.Context, driverID uint, reason string) (string, error) {
+	if _, err := findDriver(s.master, driverID); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	err := s.master.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Driver{}).Where("id = ?", driverID).
+			Updates(map[string]interface{}{"blocked": true, "blocked_reason": reason, "blocked_at": &now}).Error; err != nil {
+			return err
+		}
+
+		if err := setStatus(tx, driverID, DriverOffline, DriverAvailable, DriverOnOffer, ""); err != nil &&
+			!errors.Is(err, ErrDriverNotAvailable) {
+			return err
+		}
+
+		return tx.Model(&Offer{}).Where("driver_id = ? AND state = ?", driverID, OfferPending).
+			Update("state", OfferCancelled).Error
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.removeLocation(ctx, driverID); err != nil {
+		return "", err
+	}
+
+	s.logger.Log("Driver blocked DriverID=", driverID, "reason", reason)
+	return fmt.Sprintf("Driver %d is blocked", driverID), nil
+}
+
+// Unblock lets the driver go online again
+func (s *driverService) Unblock(ctx context.Context, driverID uint) (string, error) {
+	if _, err := findDriver(s.master, driverID); err != nil {
+		return "", err
+	}
+
+	if err := s.master.Model(&Driver{}).Where("id = ?", driverID).
+		Updates(map[string]interface{}{"blocked": false, "blocked_reason": "", "blocked_at": nil}).Error; err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Driver %d is unblocked", driverID), nil
+}
+
+// unique checks no other driver has the email or the telephone
+func unique(db *gorm.DB, driverID uint, email, telephone string) error {
+	var errs validation.Errors
+
+	for _, f := range []struct{ column, field, value string }{
+		{"email", "Email", email},
+		{"telephone", "Telephone", telephone},
+	} {
+		var count int64
+
+		if err := db.Model(&Driver{}).Where(f.column+" = ? AND id <> ?", f.value, driverID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count != 0 {
+			errs = append(errs, validation.FieldError{Field: f.field, Message: "is already registered"})
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// duplicate returns the field error of a unique index violated
+// by a concurrent registration, the other errors as they are
+func duplicate(err error) error {
+	var mysqlErr *mysql.MySQLError
+
+	if !duplicateKey(err) || !errors.As(err, &mysqlErr) {
+		return err
+	}
+
+	switch {
+	case strings.Contains(mysqlErr.Message, "idx_drivers_email"):
+		return validation.Field("Email", "is already registered")
+	case strings.Contains(mysqlErr.Message, "idx_drivers_telephone"):
+		return validation.Field("Telephone", "is already registered")
+	default:
+		return err
+	}
+}
+
+// duplicateKey reports whether the error is the violation of a unique index
+func duplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+
+	// ErrDuplicatedKey when the dialect translates the errors
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 || errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+func findDriver(db *gorm.DB, driverID uint) (Driver, error) {
+	var driver Driver
+
+	if err := db.First(&driver, "id = ?", driverID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Driver{}, ErrDriverNotFound
+		}
+
+		return Driver{}, err
+	}
+
+	return driver, nil
+}
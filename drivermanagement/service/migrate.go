@@ -0,0 +1,46 @@
+package service
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jadilet/taximicroservice/pkg/migrate"
+	"gorm.io/gorm"
+)
+
+// Migrate prepares the tables of the service, the rows which would
+// violate the unique indexes added since the tables were created
+// are fixed before AutoMigrate creates the indexes
+func Migrate(db *gorm.DB, logger log.Logger) error {
+	if err := dedupeTasks(db); err != nil {
+		return err
+	}
+
+	// the drivers registered without an email or a telephone or with the one
+	// of an older driver lose it, an admin sets it again
+	for column, index := range map[string]string{"email": "idx_drivers_email",
+		"telephone": "idx_drivers_telephone"} {
+		n, err := migrate.ClearDuplicates(db, &Driver{}, column, index)
+
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			logger.Log("msg", "Empty and duplicate driver values cleared", "column", column, "count", n)
+		}
+	}
+
+	return db.AutoMigrate(&Driver{}, &Task{}, &Offer{})
+}
+
+// dedupeTasks keeps the first task of every ride, the drivers accepted
+// the same ride on different replicas before the ride was unique.
+// The first task is the one whose acceptance was published.
+func dedupeTasks(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Task{}) || db.Migrator().HasIndex(&Task{}, "idx_tasks_ride_id") {
+		return nil
+	}
+
+	return db.Exec(`DELETE t FROM tasks t
+		JOIN (SELECT ride_id, MIN(id) AS id FROM tasks GROUP BY ride_id HAVING COUNT(*) > 1) keep
+		ON t.ride_id = keep.ride_id AND t.id <> keep.id`).Error
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// OfferEvent is pushed to the driver app when a ride is offered
+type OfferEvent struct {
+	OfferID   uint      `json:"offer_id"`
+	RideID    uint      `json:"ride_id"`
+	DriverID  uint      `json:"driver_id"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	Dist      float64   `json:"dist"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// offerHub keeps the driver apps connected to this replica
+type offerHub struct {
+	mutex sync.Mutex
+	queue string // the replica queue bound to the driver_offers exchange
+	subs  map[uint]map[chan OfferEvent]struct{}
+}
+
+func newOfferHub() *offerHub {
+	return &offerHub{subs: make(map[uint]map[chan OfferEvent]struct{})}
+}
+
+// driverRoutingKey is the driver_offers routing key of the driver offers
+func driverRoutingKey(driverID uint) string {
+	return fmt.Sprintf("driver.%d", driverID)
+}
+
+func offerEvent(offer Offer) OfferEvent {
+	return OfferEvent{
+		OfferID:   offer.ID,
+		RideID:    offer.RideID,
+		DriverID:  offer.DriverID,
+		Lat:       offer.Lat,
+		Lon:       offer.Lon,
+		Dist:      offer.Dist,
+		ExpiresAt: offer.ExpiresAt,
+	}
+}
+
+// publishOffer sends the offer to the replica the driver app is connected to,
+// the message expires with the offer
+func (s *driverService) publishOffer(offer Offer) error {
+	ttl := time.Until(offer.ExpiresAt).Milliseconds()
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(offerEvent(offer))
+
+	if err != nil {
+		return err
+	}
+
+	return s.ch.Publish(
+		"driver_offers",
+		driverRoutingKey(offer.DriverID),
+		false,
+		false,
+		amqp.Publishing{
+			ContentType: "application/json",
+			Expiration:  fmt.Sprintf("%d", ttl),
+			Body:        data,
+		})
+}
+
+// ConsumeOffers declares the replica queue of the driver_offers exchange
+// and pushes the offers to the connected driver apps
+func (s *driverService) ConsumeOffers(ctx context.Context) error {
+	q, err := s.ch.QueueDeclare(
+		"",    // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+
+	if err != nil {
+		s.logger.Log("Failed to declare a driver offers queue", err)
+		return err
+	}
+
+	msgs, err := s.ch.Consume(q.Name, "", true, true, false, false, nil)
+
+	if err != nil {
+		s.logger.Log("Failed to register a driver offers consumer", err)
+		return err
+	}
+
+	s.offers.mutex.Lock()
+	s.offers.queue = q.Name
+	s.offers.mutex.Unlock()
+
+	go func() {
+		for d := range msgs {
+			var event OfferEvent
+
+			if err := json.Unmarshal(d.Body, &event); err != nil {
+				s.logger.Log("Failed parse offer message body", err)
+				continue
+			}
+
+			s.offers.mutex.Lock()
+			for sub := range s.offers.subs[event.DriverID] {
+				select {
+				case sub <- event:
+				default:
+					s.logger.Log("Driver app is too slow, offer dropped DriverID=", event.DriverID,
+						"OfferID=", event.OfferID)
+				}
+			}
+			s.offers.mutex.Unlock()
+		}
+	}()
+
+	return nil
+}
+
+// SubscribeOffers streams the offers of the driver until ctx is done, starting with
+// the live offers of the driver so the offers sent while the app reconnected aren't lost.
+// An offer may be streamed twice, the app drops the offers it already has by offer_id.
+func (s *driverService) SubscribeOffers(ctx context.Context, driverID uint) (<-chan OfferEvent, error) {
+	driver, err := findDriver(s.slave, driverID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if driver.Blocked {
+		return nil, ErrDriverBlocked
+	}
+
+	sub := make(chan OfferEvent, 8)
+
+	if err := s.subscribe(ctx, driverID, sub); err != nil {
+		return nil, err
+	}
+
+	// read after the binding, the offers sent meanwhile come from the queue or from here
+	var live []Offer
+	if err := s.master.Where("driver_id = ? AND state = ? AND expires_at > ?",
+		driverID, OfferPending, time.Now().UTC()).Order("id").Find(&live).Error; err != nil {
+		s.logger.Log("Error reading the live offers DriverID=", driverID, "err", err)
+	}
+
+	s.offers.mutex.Lock()
+	defer s.offers.mutex.Unlock()
+
+	// the subscription may be over already
+	if _, ok := s.offers.subs[driverID][sub]; ok {
+		for _, offer := range live {
+			select {
+			case sub <- offerEvent(offer):
+			default:
+			}
+		}
+	}
+
+	return sub, nil
+}
+
+// subscribe adds the channel to the subscriptions of the driver until ctx is done,
+// the replica queue gets the offers of the driver while the driver has a subscription
+func (s *driverService) subscribe(ctx context.Context, driverID uint, sub chan OfferEvent) error {
+	s.offers.mutex.Lock()
+	defer s.offers.mutex.Unlock()
+
+	if s.offers.queue == "" {
+		return errors.New("Offers consumer isn't running")
+	}
+
+	if len(s.offers.subs[driverID]) == 0 {
+		err := s.ch.QueueBind(s.offers.queue, driverRoutingKey(driverID), "driver_offers", false, nil)
+
+		if err != nil {
+			return err
+		}
+
+		s.offers.subs[driverID] = make(map[chan OfferEvent]struct{})
+	}
+
+	s.offers.subs[driverID][sub] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+
+		s.offers.mutex.Lock()
+		defer s.offers.mutex.Unlock()
+
+		delete(s.offers.subs[driverID], sub)
+		close(sub)
+
+		if len(s.offers.subs[driverID]) == 0 {
+			delete(s.offers.subs, driverID)
+			err := s.ch.QueueUnbind(s.offers.queue, driverRoutingKey(driverID), "driver_offers", nil)
+
+			if err != nil {
+				s.logger.Log("Error unbinding driver offers DriverID=", driverID, "err", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// AckOffer records that the offer reached the driver app
+func (s *driverService) AckOffer(ctx context.Context, driverID, offerID uint) (string, error) {
+	res := s.master.Model(&Offer{}).
+		Where("id = ? AND driver_id = ? AND acked_at IS NULL", offerID, driverID).
+		Update("acked_at", time.Now().UTC())
+
+	if res.Error != nil {
+		return "", res.Error
+	}
+
+	// the offers acked before are found again, the app acks twice when it reconnects
+	if res.RowsAffected == 0 {
+		var count int64
+
+		if err := s.master.Model(&Offer{}).Where("id = ? AND driver_id = ?", offerID, driverID).
+			Count(&count).Error; err != nil {
+			return "", err
+		}
+
+		if count == 0 {
+			return "", ErrOfferNotFound
+		}
+	}
+
+	return fmt.Sprintf("Driver %d received the offer %d", driverID, offerID), nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jadilet/taximicroservice/location/pb"
+)
+
+// pingBuffer is how many pings wait for the location stream
+const pingBuffer = 4096
+
+// ErrPingsDropped is returned when the location stream can't keep up with the pings
+var ErrPingsDropped = errors.New("location stream is busy, ping dropped")
+
+// Ping queues the location of the available driver for the location stream,
+// like Set but without a gRPC call per ping
+func (s *driverService) Ping(ctx context.Context, driverID uint, lat float64, lon float64) error {
+	req, err := s.locationUpdate(driverID, lat, lon)
+
+	if err != nil || req == nil {
+		return err
+	}
+
+	select {
+	case s.pings <- req:
+		return nil
+	default:
+		return ErrPingsDropped
+	}
+}
+
+// StreamLocations forwards the queued pings to the location service
+// over one client stream, the stream is reopened when it breaks
+func (s *driverService) StreamLocations(ctx context.Context) error {
+	for {
+		err := s.streamLocations(ctx)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		s.logger.Log("Location stream closed, reopening", err)
+		time.Sleep(time.Second)
+	}
+}
+
+func (s *driverService) streamLocations(ctx context.Context) error {
+	stream, err := s.locClient.StreamLocations(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case ping := <-s.pings:
+			// the ping is lost, the next one follows in a few seconds
+			if err := stream.Send(ping); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			summary, err := stream.CloseAndRecv()
+
+			if err == nil {
+				s.logger.Log("Location stream done received", summary.Received, "rejected", summary.Rejected)
+			}
+
+			return err
+		}
+	}
+}
+
+// locationUpdate is the location sent to the location service, nil for the
+// drivers on an offer, the location of the driver on a trip carries the ride
+// so it only goes to the track and the driver stays out of the dispatch
+func (s *driverService) locationUpdate(driverID uint, lat float64, lon float64) (*pb.RequestLocation, error) {
+	var driver Driver
+
+	if err := s.master.First(&driver, "id = ?", driverID).Error; err != nil {
+		return nil, err
+	}
+
+	req := &pb.RequestLocation{Key: int32(driverID), P: &pb.Point{Latitude: lat, Longitude: lon},
+		Epoch: driver.LocationEpoch}
+
+	switch {
+	case driver.Blocked:
+		return nil, ErrDriverBlocked
+	case driver.Status == DriverOffline, driver.Status == "":
+		return nil, ErrDriverOffline
+	case driver.Status == DriverAvailable:
+		req.Attrs = locationAttrs(driver)
+		return req, nil
+	case driver.Status == DriverOnTrip:
+		var task Task
+
+		if err := s.master.Where("driver_id = ?", driverID).Order("id desc").First(&task).Error; err != nil {
+			return nil, err
+		}
+
+		req.RideId = int32(task.RideID)
+		return req, nil
+	default:
+		return nil, nil
+	}
+}
+
+// removeLocation removes the driver from the location index after the driver left
+// available, the locations of the earlier epochs still queued are refused
+func (s *driverService) removeLocation(ctx context.Context, driverID uint) error {
+	var driver Driver
+
+	if err := s.master.Select("id", "location_epoch").First(&driver, "id = ?", driverID).Error; err != nil {
+		return err
+	}
+
+	_, err := s.locClient.Remove(ctx, &pb.RequestRemove{Key: int32(driverID), Epoch: driver.LocationEpoch})
+
+	return err
+}
+
+// locationAttrs are the driver attributes the dispatcher filters the nearest drivers by
+func locationAttrs(driver Driver) map[string]string {
+	if driver.VehicleClass == "" {
+		return nil
+	}
+
+	return map[string]string{"vehicle_class": driver.VehicleClass}
+}
@@ -5,11 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/jadilet/taximicroservice/location/pb"
+	"github.com/jadilet/taximicroservice/pkg/cancelled"
+	"github.com/jadilet/taximicroservice/pkg/queues"
 	"github.com/streadway/amqp"
 
 	"gorm.io/gorm"
@@ -17,12 +18,19 @@ import (
 
 type Driver struct {
 	gorm.Model
-	UUID      string
-	Status    string
-	Name      string
-	Email     string
-	Telephone string
-	Blocked   bool `gorm:"default:false"`
+	UUID          string
+	Status        DriverStatus `gorm:"type:varchar(16);index;default:offline"`
+	Name          string
+	Email         string `gorm:"type:varchar(254);uniqueIndex:idx_drivers_email"`
+	Telephone     string `gorm:"type:varchar(32);uniqueIndex:idx_drivers_telephone"`
+	VehicleClass  string // e.g. economy, comfort, the rides filter the drivers by it
+	Blocked       bool   `gorm:"default:false"`
+	BlockedReason string `json:",omitempty"` // why an admin blocked the driver
+	BlockedAt     *time.Time
+	PasswordHash  string `json:"-"`
+	// LocationEpoch moves with the status, the location service refuses
+	// the locations read before the driver was removed from the index
+	LocationEpoch uint64 `json:"-"`
 }
 
 // Driver
@@ -30,7 +38,42 @@ type Task struct {
 	gorm.Model
 	Status   string
 	DriverID uint
-	RideID   uint
+	RideID   uint `gorm:"uniqueIndex:idx_tasks_ride_id"` // one driver per ride
+}
+
+// OfferState is the state of a ride offered to a driver
+type OfferState string
+
+const (
+	OfferPending   OfferState = "pending"
+	OfferAccepted  OfferState = "accepted"
+	OfferTaken     OfferState = "taken" // another driver accepted the ride
+	OfferExpired   OfferState = "expired"
+	OfferCancelled OfferState = "cancelled"
+)
+
+var (
+	ErrRideAccepted  = errors.New("ride has been already accepted")
+	ErrRideCancelled = errors.New("ride has been cancelled")
+	ErrNoLiveOffer   = errors.New("no live offer of the ride for the driver")
+	ErrOfferNotFound = errors.New("offer not found")
+)
+
+// offerTTL is how long the driver has to accept the offer
+const offerTTL = 15 * time.Second
+
+// Offer is a ride offered to a driver by the dispatcher
+type Offer struct {
+	gorm.Model
+	RideID    uint `gorm:"index"`
+	DriverID  uint `gorm:"index"`
+	Dist      float64
+	Lat       float64
+	Lon       float64
+	OfferedAt time.Time
+	ExpiresAt time.Time
+	State     OfferState `gorm:"type:varchar(16);index;default:pending"`
+	AckedAt   *time.Time // the driver app received the offer
 }
 
 type Ride struct {
@@ -46,12 +89,44 @@ type Ride struct {
 	SentAt      time.Time
 }
 
+// RideAccepted is published to the ride_events exchange
+// with the ride.accepted routing key
+type RideAccepted struct {
+	RideID     uint
+	DriverID   uint
+	AcceptedAt time.Time
+}
+
+// RideNoDrivers is published to the ride_events exchange with the ride.no_drivers
+// routing key when the ride is given up, the dispatcher publishes it too
+type RideNoDrivers struct {
+	RideID uint
+	At     time.Time
+}
+
 type DriverService interface {
-	Register(ctx context.Context, driver Driver) (string, error)
+	Register(ctx context.Context, driver Driver, password string) (string, error)
+	Login(ctx context.Context, email, password string) (uint, error)
+	CanLogin(ctx context.Context, driverID uint) error
+	Get(ctx context.Context, driverID uint) (Driver, error)
+	List(ctx context.Context, filter DriverFilter) (DriverPage, error)
+	Update(ctx context.Context, driverID uint, profile DriverProfile, admin bool) (Driver, error)
+	Block(ctx context.Context, driverID uint, reason string) (string, error)
+	Unblock(ctx context.Context, driverID uint) (string, error)
 	CheckResponse(ctx context.Context) error
-	Send(ctx context.Context, driverID uint, lat float64, lon float64, dist float64) (string, error)
+	Send(ctx context.Context, rideID, driverID uint, lat float64, lon float64, dist float64,
+		timeout time.Duration) (string, error)
 	Accept(ctx context.Context, driverID, rideID uint) (string, error)
 	Set(ctx context.Context, driverID uint, lat float64, lon float64) error
+	Ping(ctx context.Context, driverID uint, lat float64, lon float64) error
+	StreamLocations(ctx context.Context) error
+	ConsumeOffers(ctx context.Context) error
+	SubscribeOffers(ctx context.Context, driverID uint) (<-chan OfferEvent, error)
+	AckOffer(ctx context.Context, driverID, offerID uint) (string, error)
+	GoOnline(ctx context.Context, driverID uint) (string, error)
+	GoOffline(ctx context.Context, driverID uint) (string, error)
+	ConsumeRideFinished(ctx context.Context) error
+	SweepOffers(ctx context.Context) error
 }
 
 type DriverLocationService interface {
@@ -63,24 +138,36 @@ type driverService struct {
 	master    *gorm.DB
 	slave     *gorm.DB
 	ch        *amqp.Channel
-	mutex     sync.Mutex
 	locClient pb.LocationClient
+	cancelled cancelled.Rides
+	offers    *offerHub
+	pings     chan *pb.RequestLocation
 }
 
-func NewDriverService(log log.Logger, master *gorm.DB, slave *gorm.DB, ch *amqp.Channel, locClient pb.LocationClient) DriverService {
-	return &driverService{logger: log, master: master, slave: slave, ch: ch, locClient: locClient}
+func NewDriverService(log log.Logger, master *gorm.DB, slave *gorm.DB, ch *amqp.Channel, locClient pb.LocationClient,
+	cancelledRides cancelled.Rides) DriverService {
+	return &driverService{logger: log, master: master, slave: slave, ch: ch, locClient: locClient,
+		cancelled: cancelledRides, offers: newOfferHub(), pings: make(chan *pb.RequestLocation, pingBuffer)}
 }
 
+// Set indexes the location of the available driver
+// and records the route of the driver on a trip
 func (s *driverService) Set(ctx context.Context, driverID uint, lat float64, lon float64) error {
-	_, err := s.locClient.Set(ctx, &pb.RequestLocation{Key: int32(driverID), P: &pb.Point{Latitude: lat, Longitude: lon}})
+	req, err := s.locationUpdate(driverID, lat, lon)
+
+	if err != nil || req == nil {
+		return err
+	}
+
+	_, err = s.locClient.Set(ctx, req)
 
 	return err
 }
 
+// Accept assigns the ride to the driver of a live offer. The replicas may accept
+// the offers of the ride at the same time, the unique ride of the tasks lets one
+// of them in and the offer moves to accepted only while it's pending and live.
 func (s *driverService) Accept(ctx context.Context, driverID, rideID uint) (string, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
 	var driver Driver
 
 	if err := s.master.First(&driver, "id = ?", driverID).Error; err != nil {
@@ -88,48 +175,162 @@ func (s *driverService) Accept(ctx context.Context, driverID, rideID uint) (stri
 	}
 
 	if driver.Blocked {
-		return "", errors.New("Driver blocked")
+		return "", ErrDriverBlocked
+	}
+
+	isCancelled, err := s.cancelled.Has(ctx, rideID)
+
+	if err != nil {
+		return "", err
 	}
 
-	var task Task
-	if resp := s.master.Where("ride_id = ?", rideID).First(&task); resp.Error != nil {
+	if isCancelled {
+		return "", ErrRideCancelled
+	}
 
-		if !errors.Is(resp.Error, gorm.ErrRecordNotFound) {
-			return "", resp.Error
+	var offer Offer
+	if err := s.master.Where("ride_id = ? AND driver_id = ? AND state = ? AND expires_at > ?",
+		rideID, driverID, OfferPending, time.Now().UTC()).
+		Order("id desc").First(&offer).Error; err != nil {
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrNoLiveOffer
 		}
 
-		if err := s.master.Transaction(func(tx *gorm.DB) error {
-			if err := tx.Create(&Task{DriverID: driverID, RideID: rideID}).Error; err != nil {
-				return err
+		return "", err
+	}
+
+	err = s.master.Transaction(func(tx *gorm.DB) error {
+		// the task is inserted first, a concurrent accept of the ride waits
+		// on the unique index until this one commits or rolls back
+		if err := tx.Create(&Task{DriverID: driverID, RideID: rideID}).Error; err != nil {
+			if duplicateKey(err) {
+				return ErrRideAccepted
 			}
 
-			return nil
-		}); err != nil {
-			return "", err
+			return err
+		}
+
+		res := tx.Model(&Offer{}).Where("id = ? AND state = ? AND expires_at > ?",
+			offer.ID, OfferPending, time.Now().UTC()).Update("state", OfferAccepted)
+
+		if res.Error != nil {
+			return res.Error
 		}
 
-		return fmt.Sprintf("Driver %d accepted the ride %d", driverID, rideID), nil
+		// the offer expired or was closed since it was read
+		if res.RowsAffected != 1 {
+			return ErrNoLiveOffer
+		}
+
+		if err := setStatus(tx, driverID, DriverOnTrip, DriverOnOffer); err != nil {
+			return err
+		}
+
+		// the other drivers can't accept the ride anymore
+		return closeOffers(tx, rideID, OfferTaken)
+	})
+
+	if err != nil {
+		return "", err
 	}
 
-	return "", fmt.Errorf("Ride has been already accepted RideID=%d", rideID)
+	return fmt.Sprintf("Driver %d accepted the ride %d", driverID, rideID), nil
 }
 
-func (s *driverService) Send(ctx context.Context, driverID uint, lat float64,
-	lon float64, dist float64) (string, error) {
+func (s *driverService) Send(ctx context.Context, rideID, driverID uint, lat float64,
+	lon float64, dist float64, timeout time.Duration) (string, error) {
+
+	var driver Driver
+
+	if err := s.slave.First(&driver, "id = ?", driverID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrDriverNotFound
+		}
+
+		return "", err
+	}
+
+	if driver.Blocked {
+		return "", ErrDriverBlocked
+	}
+
+	if timeout <= 0 {
+		timeout = offerTTL
+	}
+
+	now := time.Now().UTC()
+	offer := Offer{
+		RideID:    rideID,
+		DriverID:  driverID,
+		Dist:      dist,
+		Lat:       lat,
+		Lon:       lon,
+		OfferedAt: now,
+		ExpiresAt: now.Add(timeout),
+		State:     OfferPending,
+	}
+
+	// the driver gets one offer at a time
+	if err := s.master.Transaction(func(tx *gorm.DB) error {
+		if err := setStatus(tx, driverID, DriverOnOffer, DriverAvailable); err != nil {
+			return err
+		}
 
-	if err := s.slave.First(&Driver{}, "id = ?", driverID).Error; err != nil {
+		return tx.Create(&offer).Error
+	}); err != nil {
 		return "", err
 	}
 
-	s.logger.Log("Offered a ride to the driver ", driverID, " distance: ", dist, "km")
-	return fmt.Sprintf("Offered a ride to the driver %d distance %v km", driverID, dist), nil
+	if err := s.removeLocation(ctx, driverID); err != nil {
+		s.logger.Log("Error removing the driver from the location index DriverID=", driverID, "err", err)
+	}
+
+	if err := s.publishOffer(offer); err != nil {
+		return "", err
+	}
+
+	s.logger.Log("Offered a ride ", rideID, " to the driver ", driverID, " distance: ", dist, "km")
+	return fmt.Sprintf("Offered the ride %d to the driver %d distance %v km", rideID, driverID, dist), nil
 }
 
-func (s *driverService) Register(ctx context.Context, driver Driver) (string, error) {
+// closeOffers moves the pending offers of the ride to the state
+// and makes their drivers available again
+func closeOffers(db *gorm.DB, rideID uint, state OfferState) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var driverIDs []uint
+
+		if err := tx.Model(&Offer{}).Where("ride_id = ? AND state = ?", rideID, OfferPending).
+			Pluck("driver_id", &driverIDs).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Offer{}).Where("ride_id = ? AND state = ?", rideID, OfferPending).
+			Update("state", state).Error; err != nil {
+			return err
+		}
+
+		return releaseDrivers(tx, driverIDs)
+	})
+}
+
+func (s *driverService) Register(ctx context.Context, driver Driver, password string) (string, error) {
+	hash, err := hashPassword(password)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := unique(s.master, 0, driver.Email, driver.Telephone); err != nil {
+		return "", err
+	}
+
+	driver.PasswordHash = hash
+	driver.Status = DriverOffline
 	res := s.master.Create(&driver)
 
 	if res.Error != nil {
-		return "", res.Error
+		return "", duplicate(res.Error)
 	}
 
 	return fmt.Sprintf("Successfully added a new driver ID: %d", driver.ID), nil
@@ -160,48 +361,86 @@ func (s *driverService) CheckResponse(ctx context.Context) error {
 
 			if err != nil {
 				s.logger.Log("Failed parse ride message body")
-				if err := d.Nack(false, true); err != nil {
-					s.logger.Log("Error negative acknowledging the ride", err)
-				}
+				s.reject(d)
 				continue
 			}
 
 			s.logger.Log("DriverManagement processing the ride ", ride.ID)
 
-			// Wait for 15 seconds for driver response
+			// The dispatcher delays the ride for the response timeout,
+			// the ride arrives here when the drivers had time to respond.
 			// If doesn't accept the ride then resend the ride
 			// to the dispatcher service
 			elapsed := time.Now().UTC().Sub(ride.SentAt)
-			s.logger.Log("Checking response elapsed time", elapsed)
-			if elapsed < time.Second*15 {
-				s.logger.Log("Waiting driver response for RideID", ride.ID, "elapsed", time.Second*15-elapsed)
-				time.Sleep(time.Second*15 - elapsed)
+			s.logger.Log("Checking response RideID", ride.ID, "elapsed time", elapsed)
+
+			isCancelled, err := s.cancelled.Has(ctx, ride.ID)
+
+			if err != nil {
+				s.logger.Log("Error reading the cancelled rides RideID=", ride.ID, "err", err)
+				s.retry(d, "waiting_driver_response")
+				continue
 			}
 
-			if elapsed > time.Hour*1 {
+			if isCancelled {
+				if err := closeOffers(s.master, ride.ID, OfferCancelled); err != nil {
+					s.logger.Log("Error cancelling the offers of RideID=", ride.ID, "err", err)
+				}
 				if err := d.Ack(false); err != nil {
 					s.logger.Log("Error ackowledging the ride", err)
 				}
-				s.logger.Log("Old ride acknowledged RideID=", ride.ID)
+				s.logger.Log("Cancelled ride dropped RideID=", ride.ID)
 				continue
 			}
 
 			var task Task
-			if resp := s.slave.Where("ride_id = ?", ride.ID).First(&task); resp.Error != nil && errors.Is(resp.Error, gorm.ErrRecordNotFound) {
+			resp := s.slave.Where("ride_id = ?", ride.ID).First(&task)
+
+			if resp.Error != nil && !errors.Is(resp.Error, gorm.ErrRecordNotFound) {
+				s.logger.Log("Error reading the task of RideID=", ride.ID, "err", resp.Error)
+				s.retry(d, "waiting_driver_response")
+				continue
+			}
+
+			if resp.Error != nil && elapsed > time.Hour*1 {
+				if err := closeOffers(s.master, ride.ID, OfferExpired); err != nil {
+					s.logger.Log("Error expiring the offers of RideID=", ride.ID, "err", err)
+				}
+
+				// the ride isn't dispatched anymore, the trip management service
+				// moves it to no drivers available instead of leaving it dispatching
+				if err := s.publishNoDrivers(ride.ID); err != nil {
+					s.logger.Log("Error publishing no drivers available RideID=", ride.ID, "err", err)
+					s.retry(d, "waiting_driver_response")
+					continue
+				}
+
+				if err := d.Ack(false); err != nil {
+					s.logger.Log("Error ackowledging the ride", err)
+				}
+				s.logger.Log("Old ride given up RideID=", ride.ID)
+				continue
+			}
+
+			if resp.Error != nil {
+				if err := closeOffers(s.master, ride.ID, OfferExpired); err != nil {
+					s.logger.Log("Error expiring the offers of RideID=", ride.ID, "err", err)
+				}
+
 				if err := s.ch.Publish(
 					"",
 					"open_ride_queue",
 					false,
 					false,
 					amqp.Publishing{
+						Headers:      d.Headers,
 						DeliveryMode: amqp.Persistent,
 						ContentType:  "application/json",
 						Body:         d.Body,
 					}); err != nil {
-					s.logger.Log("Error to write a ride to the waiting_driver_response channel ", ride.ID)
-					if err := d.Nack(false, true); err != nil {
-						s.logger.Log("Error negative acknowledging the ride", err)
-					}
+					s.logger.Log("Error to write a ride to the open_ride_queue channel ", ride.ID)
+					s.retry(d, "waiting_driver_response")
+					continue
 				}
 
 				if err := d.Ack(false); err != nil {
@@ -209,10 +448,33 @@ func (s *driverService) CheckResponse(ctx context.Context) error {
 				}
 
 			} else {
+				data, err := json.Marshal(RideAccepted{RideID: task.RideID, DriverID: task.DriverID,
+					AcceptedAt: task.CreatedAt.UTC()})
+
+				if err != nil {
+					s.logger.Log("Error encoding ride acceptance to json ", err)
+					s.retry(d, "waiting_driver_response")
+					continue
+				}
+
+				if err := s.ch.Publish(
+					"ride_events",
+					"ride.accepted",
+					false,
+					false,
+					amqp.Publishing{
+						DeliveryMode: amqp.Persistent,
+						ContentType:  "application/json",
+						Body:         data,
+					}); err != nil {
+					s.logger.Log("Error publishing ride acceptance RideID=", ride.ID, "err", err)
+					s.retry(d, "waiting_driver_response")
+					continue
+				}
+
 				if err := d.Ack(false); err != nil {
 					s.logger.Log("Error ackowledging the ride", err)
 				}
-				// TODO PUBLISH Message to other services
 				s.logger.Log("Ride accepted by DriverID=", task.DriverID, "RideID=", task.RideID)
 			}
 
@@ -224,3 +486,33 @@ func (s *driverService) CheckResponse(ctx context.Context) error {
 
 	return nil
 }
+
+// publishNoDrivers tells the trip management service the ride is given up
+func (s *driverService) publishNoDrivers(rideID uint) error {
+	data, err := json.Marshal(RideNoDrivers{RideID: rideID, At: time.Now().UTC()})
+
+	if err != nil {
+		return err
+	}
+
+	return s.ch.Publish(
+		"ride_events",
+		"ride.no_drivers",
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Body:         data,
+		})
+}
+
+// retry puts the message to the next delay queue, see queues.Retry
+func (s *driverService) retry(d amqp.Delivery, queue string) {
+	queues.Retry(s.ch, d, queue, s.logger)
+}
+
+// reject parks the poison message in the dead letter queue
+func (s *driverService) reject(d amqp.Delivery) {
+	queues.Reject(d, s.logger)
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/jadilet/taximicroservice/location/pb"
+	"github.com/jadilet/taximicroservice/pkg/cancelled"
+	"google.golang.org/grpc"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService runs the service on an in-memory SQLite database,
+// one connection so every query sees the same database
+func newTestService(t *testing.T) *driverService {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger:         logger.Discard,
+		TranslateError: true,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB, err := db.DB()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&Driver{}, &Task{}, &Offer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return &driverService{logger: log.NewNopLogger(), master: db, slave: db,
+		cancelled: cancelled.NewMemoryRides(time.Hour), offers: newOfferHub()}
+}
+
+func addDriver(t *testing.T, db *gorm.DB, status DriverStatus, blocked bool) Driver {
+	t.Helper()
+
+	var count int64
+	db.Model(&Driver{}).Count(&count)
+
+	driver := Driver{Name: "driver", Email: fmt.Sprintf("driver%d@example.com", count),
+		Telephone: fmt.Sprintf("+7700000%04d", count), Status: status, Blocked: blocked}
+
+	if err := db.Create(&driver).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return driver
+}
+
+func addOffer(t *testing.T, db *gorm.DB, rideID, driverID uint, expiresAt time.Time) Offer {
+	t.Helper()
+
+	offer := Offer{RideID: rideID, DriverID: driverID, OfferedAt: expiresAt.Add(-offerTTL),
+		ExpiresAt: expiresAt, State: OfferPending}
+
+	if err := db.Create(&offer).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return offer
+}
+
+func driverStatus(t *testing.T, db *gorm.DB, driverID uint) DriverStatus {
+	t.Helper()
+
+	var driver Driver
+	if err := db.First(&driver, driverID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return driver.Status
+}
+
+func offerState(t *testing.T, db *gorm.DB, offerID uint) OfferState {
+	t.Helper()
+
+	var offer Offer
+	if err := db.First(&offer, offerID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return offer.State
+}
+
+func tasks(t *testing.T, db *gorm.DB, rideID uint) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(&Task{}).Where("ride_id = ?", rideID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestAcceptTwice(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	live := time.Now().UTC().Add(offerTTL)
+
+	first := addDriver(t, s.master, DriverOnOffer, false)
+	second := addDriver(t, s.master, DriverOnOffer, false)
+	firstOffer := addOffer(t, s.master, 1, first.ID, live)
+	secondOffer := addOffer(t, s.master, 1, second.ID, live)
+
+	if _, err := s.Accept(ctx, first.ID, 1); err != nil {
+		t.Fatalf("Accept(%d) error = %v", first.ID, err)
+	}
+
+	// the same driver again and the driver whose offer was taken
+	for _, driverID := range []uint{first.ID, second.ID} {
+		if _, err := s.Accept(ctx, driverID, 1); err != ErrNoLiveOffer {
+			t.Errorf("Accept(%d) again error = %v, want %v", driverID, err, ErrNoLiveOffer)
+		}
+	}
+
+	if n := tasks(t, s.master, 1); n != 1 {
+		t.Errorf("tasks of the ride = %d, want 1", n)
+	}
+
+	if got := offerState(t, s.master, firstOffer.ID); got != OfferAccepted {
+		t.Errorf("accepted offer state = %s, want %s", got, OfferAccepted)
+	}
+
+	if got := offerState(t, s.master, secondOffer.ID); got != OfferTaken {
+		t.Errorf("other offer state = %s, want %s", got, OfferTaken)
+	}
+
+	if got := driverStatus(t, s.master, first.ID); got != DriverOnTrip {
+		t.Errorf("accepting driver status = %s, want %s", got, DriverOnTrip)
+	}
+
+	if got := driverStatus(t, s.master, second.ID); got != DriverAvailable {
+		t.Errorf("other driver status = %s, want %s", got, DriverAvailable)
+	}
+}
+
+func TestAcceptOnAnotherReplica(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	driver := addDriver(t, s.master, DriverOnOffer, false)
+	offer := addOffer(t, s.master, 1, driver.ID, time.Now().UTC().Add(offerTTL))
+
+	// another replica committed the task of the ride after the offer was read
+	if err := s.master.Create(&Task{DriverID: driver.ID + 1, RideID: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Accept(ctx, driver.ID, 1); err != ErrRideAccepted {
+		t.Fatalf("Accept error = %v, want %v", err, ErrRideAccepted)
+	}
+
+	// the transaction rolled back, the other replica closes the offer
+	if got := offerState(t, s.master, offer.ID); got != OfferPending {
+		t.Errorf("offer state = %s, want %s", got, OfferPending)
+	}
+
+	if got := driverStatus(t, s.master, driver.ID); got != DriverOnOffer {
+		t.Errorf("driver status = %s, want %s", got, DriverOnOffer)
+	}
+}
+
+func TestAcceptExpiredOffer(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	driver := addDriver(t, s.master, DriverOnOffer, false)
+	offer := addOffer(t, s.master, 1, driver.ID, time.Now().UTC().Add(-time.Second))
+
+	if _, err := s.Accept(ctx, driver.ID, 1); err != ErrNoLiveOffer {
+		t.Fatalf("Accept error = %v, want %v", err, ErrNoLiveOffer)
+	}
+
+	if n := tasks(t, s.master, 1); n != 0 {
+		t.Errorf("tasks of the ride = %d, want 0", n)
+	}
+
+	if got := offerState(t, s.master, offer.ID); got != OfferPending {
+		t.Errorf("offer state = %s, want %s", got, OfferPending)
+	}
+}
+
+func TestAcceptCancelledRide(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	driver := addDriver(t, s.master, DriverOnOffer, false)
+	addOffer(t, s.master, 1, driver.ID, time.Now().UTC().Add(offerTTL))
+
+	if err := s.cancelled.Add(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Accept(ctx, driver.ID, 1); err != ErrRideCancelled {
+		t.Fatalf("Accept error = %v, want %v", err, ErrRideCancelled)
+	}
+}
+
+func TestReleaseExpiredOffers(t *testing.T) {
+	s := newTestService(t)
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name      string
+		status    DriverStatus
+		blocked   bool
+		expiresAt time.Time // no offer when zero
+		want      DriverStatus
+		wantState OfferState
+	}{
+		{"expired offer", DriverOnOffer, false, now.Add(-2 * offerGrace), DriverAvailable, OfferExpired},
+		{"blocked on offer", DriverOnOffer, true, now.Add(-2 * offerGrace), DriverOffline, OfferExpired},
+		{"within the grace", DriverOnOffer, false, now.Add(-time.Second), DriverOnOffer, OfferPending},
+		{"live offer", DriverOnOffer, false, now.Add(offerTTL), DriverOnOffer, OfferPending},
+		{"on offer without an offer", DriverOnOffer, false, time.Time{}, DriverAvailable, ""},
+		{"on trip", DriverOnTrip, false, time.Time{}, DriverOnTrip, ""},
+		{"offline", DriverOffline, false, time.Time{}, DriverOffline, ""},
+	}
+
+	drivers := make([]Driver, len(tests))
+	offers := make([]Offer, len(tests))
+
+	for i, tt := range tests {
+		drivers[i] = addDriver(t, s.master, tt.status, tt.blocked)
+
+		if !tt.expiresAt.IsZero() {
+			offers[i] = addOffer(t, s.master, uint(i+1), drivers[i].ID, tt.expiresAt)
+		}
+	}
+
+	n, err := s.releaseExpiredOffers(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Errorf("released %d drivers, want 3", n)
+	}
+
+	for i, tt := range tests {
+		if got := driverStatus(t, s.master, drivers[i].ID); got != tt.want {
+			t.Errorf("%s: driver status = %s, want %s", tt.name, got, tt.want)
+		}
+
+		if tt.wantState == "" {
+			continue
+		}
+
+		if got := offerState(t, s.master, offers[i].ID); got != tt.wantState {
+			t.Errorf("%s: offer state = %s, want %s", tt.name, got, tt.wantState)
+		}
+	}
+}
+
+// fakeLocationClient records the removals of the drivers
+type fakeLocationClient struct {
+	pb.LocationClient
+	removed []*pb.RequestRemove
+}
+
+func (c *fakeLocationClient) Remove(ctx context.Context, in *pb.RequestRemove,
+	opts ...grpc.CallOption) (*empty.Empty, error) {
+	c.removed = append(c.removed, in)
+	return &empty.Empty{}, nil
+}
+
+func TestRemoveRefusesQueuedPings(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		remove func(s *driverService, driverID uint) error
+	}{
+		{"offline", func(s *driverService, driverID uint) error {
+			_, err := s.GoOffline(ctx, driverID)
+			return err
+		}},
+		{"blocked", func(s *driverService, driverID uint) error {
+			_, err := s.Block(ctx, driverID, "test")
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			locations := &fakeLocationClient{}
+			s.locClient = locations
+			driver := addDriver(t, s.master, DriverAvailable, false)
+
+			// the ping is read while the driver is available and sent after the removal
+			ping, err := s.locationUpdate(driver.ID, 43.25, 76.95)
+
+			if err != nil || ping == nil {
+				t.Fatalf("locationUpdate = %v, %v, want the location", ping, err)
+			}
+
+			if err := tt.remove(s, driver.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(locations.removed) != 1 {
+				t.Fatalf("removed %d times, want once", len(locations.removed))
+			}
+
+			if removal := locations.removed[0]; removal.Epoch <= ping.Epoch {
+				t.Errorf("removal epoch %d, want after the ping epoch %d", removal.Epoch, ping.Epoch)
+			}
+		})
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-kit/kit/log"
 
+	kitjwt "github.com/go-kit/kit/auth/jwt"
 	gt "github.com/go-kit/kit/transport/grpc"
 	httptransport "github.com/go-kit/kit/transport/http"
 
@@ -16,6 +21,10 @@ import (
 	"github.com/jadilet/taximicroservice/drivermanagement/endpoints"
 	"github.com/jadilet/taximicroservice/drivermanagement/pb"
 	"github.com/jadilet/taximicroservice/drivermanagement/service"
+	"github.com/jadilet/taximicroservice/pkg/auth"
+	"github.com/jadilet/taximicroservice/pkg/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type errorer interface {
@@ -27,6 +36,9 @@ var (
 	// It always indicates programmer error.
 	ErrBadRouting = errors.New("inconsistent mapping between route and handler")
 
+	// ErrInvalidID is returned when the ID in the path isn't a number.
+	ErrInvalidID = errors.New("invalid id")
+
 	ErrInconsistentIDs = errors.New("inconsistent IDs")
 	ErrAlreadyExists   = errors.New("already exists")
 	ErrNotFound        = errors.New("not found")
@@ -51,36 +63,53 @@ func (s *gRPCServer) Send(ctx context.Context, req *pb.Request) (*pb.Response, e
 	_, resp, err := s.send.ServeGRPC(ctx, req)
 
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
 	}
 
 	return resp.(*pb.Response), nil
 }
 
+// grpcError returns the service errors with their gRPC status codes,
+// the errors of the database and the broker are Unavailable so the callers retry later
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrDriverNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrDriverBlocked), errors.Is(err, service.ErrDriverOffline),
+		errors.Is(err, service.ErrDriverNotAvailable), errors.Is(err, service.ErrDriverOnTrip):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
+
 func decodeSendRequest(_ context.Context, request interface{}) (interface{}, error) {
 	req := request.(*pb.Request)
 
-	return endpoints.RideReq{DriverID: uint(req.Driverid),
-		Dist: req.Dist,
-		Lat:  req.Lat,
-		Lon:  req.Lon}, nil
+	return endpoints.RideReq{RideID: uint(req.Rideid),
+		DriverID: uint(req.Driverid),
+		Dist:     req.Dist,
+		Lat:      req.Lat,
+		Lon:      req.Lon,
+		Timeout:  time.Duration(req.Timeout) * time.Second}, nil
 }
 
 func encodeSendResponse(_ context.Context, response interface{}) (interface{}, error) {
 	resp := response.(endpoints.RideResp)
 
-	if resp.Err != nil {
-		return &pb.Response{Msg: resp.Msg, Err: resp.Err.Error()}, nil
-	}
-
 	return &pb.Response{Msg: resp.Msg}, nil
 }
 
-func MakeHTTPHandler(s service.DriverService, logger log.Logger) http.Handler {
+// MakeHTTPHandler serves the driver apps, the requests carry the access token
+// of the driver in the Authorization: Bearer header
+func MakeHTTPHandler(s service.DriverService, keys *auth.Keys, logger log.Logger) http.Handler {
 	r := mux.NewRouter()
-	e := endpoints.MakeHttpEndpoint(s)
+	e := endpoints.MakeHttpEndpoint(s, keys)
 
 	options := []httptransport.ServerOption{
+		httptransport.ServerBefore(kitjwt.HTTPToContext()),
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
 	}
@@ -93,6 +122,22 @@ func MakeHTTPHandler(s service.DriverService, logger log.Logger) http.Handler {
 			options...,
 		))
 
+	r.Methods("POST").Path("/driver/login/").Handler(
+		httptransport.NewServer(
+			e.Login,
+			decodePostLoginReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/driver/token/refresh/").Handler(
+		httptransport.NewServer(
+			e.Refresh,
+			decodePostRefreshReq,
+			encodeResponse,
+			options...,
+		))
+
 	r.Methods("POST").Path("/driver/accept/").Handler(
 		httptransport.NewServer(
 			e.Accept,
@@ -109,9 +154,192 @@ func MakeHTTPHandler(s service.DriverService, logger log.Logger) http.Handler {
 			options...,
 		))
 
+	r.Methods("POST").Path("/driver/{id}/online").Handler(
+		httptransport.NewServer(
+			e.Online,
+			decodeDriverIDReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/driver/{id}/offline").Handler(
+		httptransport.NewServer(
+			e.Offline,
+			decodeDriverIDReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("GET").Path("/driver/").Handler(
+		httptransport.NewServer(
+			e.List,
+			decodeListReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("GET").Path("/driver/{id:[0-9]+}").Handler(
+		httptransport.NewServer(
+			e.Get,
+			decodeDriverIDReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("PUT").Path("/driver/{id:[0-9]+}").Handler(
+		httptransport.NewServer(
+			e.Update,
+			decodePutDriverReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/driver/{id:[0-9]+}/block").Handler(
+		httptransport.NewServer(
+			e.Block,
+			decodePostBlockReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/driver/{id:[0-9]+}/unblock").Handler(
+		httptransport.NewServer(
+			e.Unblock,
+			decodeDriverIDReq,
+			encodeResponse,
+			options...,
+		))
+
+	// driver apps keep this request open to send the locations
+	r.Methods("POST").Path("/driver/{id}/locations").Handler(makeLocationStreamHandler(s, keys, logger))
+
+	// driver apps keep this stream open to receive the offers
+	r.Methods("GET").Path("/driver/{id}/offers").Handler(makeOfferStreamHandler(s, keys, logger))
+
+	r.Methods("POST").Path("/driver/offers/{id}/ack").Handler(
+		httptransport.NewServer(
+			e.AckOffer,
+			decodePostOfferAckReq,
+			encodeResponse,
+			options...,
+		))
+
 	return r
 }
 
+// makeOfferStreamHandler pushes the driver offers as server-sent events
+func makeOfferStreamHandler(s service.DriverService, keys *auth.Keys, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		driverID, err := streamDriverID(r, keys)
+		if err != nil {
+			encodeError(ctx, err, w)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			encodeError(ctx, errors.New("streaming unsupported"), w)
+			return
+		}
+
+		offers, err := s.SubscribeOffers(ctx, driverID)
+		if err != nil {
+			encodeError(ctx, err, w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case offer, ok := <-offers:
+				if !ok {
+					return
+				}
+
+				data, err := json.Marshal(offer)
+				if err != nil {
+					logger.Log("Error encoding offer", err)
+					continue
+				}
+
+				fmt.Fprintf(w, "id: %d\nevent: offer\ndata: %s\n\n", offer.OfferID, data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			flusher.Flush()
+		}
+	})
+}
+
+// LocationStreamResp is written when the driver app closes the location stream
+type LocationStreamResp struct {
+	Received int    `json:"received"`
+	Dropped  int    `json:"dropped"`
+	Err      string `json:"err,omitempty"`
+}
+
+// makeLocationStreamHandler reads the driver locations from a long-lived request body,
+// one JSON object per line e.g. {"Lat":43.25,"Lon":76.92}
+func makeLocationStreamHandler(s service.DriverService, keys *auth.Keys, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		driverID, err := streamDriverID(r, keys)
+		if err != nil {
+			encodeError(ctx, err, w)
+			return
+		}
+
+		var resp LocationStreamResp
+		dec := json.NewDecoder(r.Body)
+
+		for {
+			var loc endpoints.LocReq
+
+			if err := dec.Decode(&loc); err != nil {
+				if err != io.EOF {
+					resp.Err = err.Error()
+				}
+				break
+			}
+
+			if err := validation.Struct(loc); err != nil {
+				resp.Err = err.Error()
+				break
+			}
+
+			resp.Received++
+			err := s.Ping(ctx, driverID, loc.Lat, loc.Lon)
+
+			if errors.Is(err, service.ErrPingsDropped) {
+				resp.Dropped++
+				continue
+			}
+
+			// the driver went offline or was blocked, the app has to reconnect
+			if err != nil {
+				logger.Log("Location stream closed DriverID=", driverID, "err", err)
+				encodeError(ctx, err, w)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if e, ok := response.(errorer); ok && e.error() != nil {
 		encodeError(ctx, e.error(), w)
@@ -123,7 +351,7 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 
 func decodePostDriverSetReq(_ context.Context, r *http.Request) (request interface{}, err error) {
 	var req endpoints.LocReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := validation.Decode(r.Body, &req); err != nil {
 		return nil, err
 	}
 
@@ -132,7 +360,25 @@ func decodePostDriverSetReq(_ context.Context, r *http.Request) (request interfa
 
 func decodePostDriverRegisterReq(_ context.Context, r *http.Request) (request interface{}, err error) {
 	var req endpoints.DriverRegisterReq
-	if err := json.NewDecoder(r.Body).Decode(&req.Driver); err != nil {
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodePostLoginReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req endpoints.LoginReq
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodePostRefreshReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req endpoints.RefreshReq
+	if err := validation.Decode(r.Body, &req); err != nil {
 		return nil, err
 	}
 
@@ -141,13 +387,121 @@ func decodePostDriverRegisterReq(_ context.Context, r *http.Request) (request in
 
 func decodePostDriverAcceptReq(_ context.Context, r *http.Request) (request interface{}, err error) {
 	var req endpoints.DriverAcceptReq
-	if err := json.NewDecoder(r.Body).Decode(&req.Task); err != nil {
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodeDriverIDReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	driverID, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints.DriverIDReq{DriverID: driverID}, nil
+}
+
+// decodeListReq reads the filter of the query e.g. ?status=available&blocked=false&page=2&per_page=50
+func decodeListReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	filter := service.DriverFilter{Status: service.DriverStatus(q.Get("status"))}
+
+	if v := q.Get("blocked"); v != "" {
+		blocked, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, validation.Field("blocked", "must be true or false")
+		}
+		filter.Blocked = &blocked
+	}
+
+	for name, dst := range map[string]*int{"page": &filter.Page, "per_page": &filter.PerPage} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, validation.Field(name, "must be a positive number")
+			}
+			*dst = n
+		}
+	}
+
+	return endpoints.ListReq{Filter: filter}, nil
+}
+
+func decodePutDriverReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	driverID, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := endpoints.UpdateReq{DriverID: driverID}
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodePostBlockReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	driverID, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := endpoints.BlockReq{DriverID: driverID}
+	if err := validation.Decode(r.Body, &req); err != nil {
 		return nil, err
 	}
 
 	return req, nil
 }
 
+func decodePostOfferAckReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	offerID, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints.AckOfferReq{OfferID: offerID}, nil
+}
+
+// pathID reads the {id} path variable
+func pathID(r *http.Request) (uint, error) {
+	vars := mux.Vars(r)
+	v, ok := vars["id"]
+	if !ok {
+		return 0, ErrBadRouting
+	}
+
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidID
+	}
+
+	return uint(id), nil
+}
+
+// streamDriverID returns the driver of the path if the request has their access token,
+// the streams aren't go-kit endpoints so they check the token here
+func streamDriverID(r *http.Request, keys *auth.Keys) (uint, error) {
+	driverID, err := pathID(r)
+	if err != nil {
+		return 0, err
+	}
+
+	claims, err := keys.FromRequest(r, auth.RoleDriver)
+	if err != nil {
+		return 0, err
+	}
+
+	if claims.Subject != strconv.FormatUint(uint64(driverID), 10) {
+		return 0, auth.ErrForbidden
+	}
+
+	return driverID, nil
+}
+
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
 		panic("encodeError with nil error")
@@ -155,17 +509,54 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(codeFrom(err))
 
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+	body := map[string]interface{}{
 		"error": err.Error(),
-	})
+	}
+
+	// the fields which aren't valid e.g. {"field": "Email", "message": "must be an email address"}
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		body["error"] = "invalid request"
+		body["fields"] = fieldErrs
+	}
+
+	_ = json.NewEncoder(w).Encode(body)
 }
 
 func codeFrom(err error) int {
+	// the errors of the location service
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+
+	if auth.IsAuthError(err) {
+		return http.StatusUnauthorized
+	}
+
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		return http.StatusBadRequest
+	}
+
 	switch err {
-	case ErrNotFound:
+	case auth.ErrForbidden, service.ErrAdminOnly:
+		return http.StatusForbidden
+	case service.ErrInvalidCredentials:
+		return http.StatusUnauthorized
+	case service.ErrPasswordTooShort:
+		return http.StatusBadRequest
+	case ErrNotFound, service.ErrDriverNotFound, service.ErrOfferNotFound:
 		return http.StatusNotFound
-	case ErrAlreadyExists, ErrInconsistentIDs:
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrInvalidID:
 		return http.StatusBadRequest
+	case service.ErrDriverBlocked:
+		return http.StatusForbidden
+	case service.ErrDriverOffline, service.ErrDriverNotAvailable, service.ErrDriverOnTrip,
+		service.ErrRideAccepted, service.ErrRideCancelled, service.ErrNoLiveOffer:
+		return http.StatusConflict
 	default:
 		return http.StatusInternalServerError
 	}
@@ -1,20 +1,29 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	"github.com/go-redis/redis"
 	"github.com/jadilet/taximicroservice/location/endpoints"
 	"github.com/jadilet/taximicroservice/location/pb"
 	"github.com/jadilet/taximicroservice/location/service"
 	"github.com/jadilet/taximicroservice/location/transports"
+	"github.com/jadilet/taximicroservice/pkg/mtls"
 	"github.com/joho/godotenv"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -31,28 +40,171 @@ func main() {
 		level.Info(logger).Log("msg", "failed to read .env file", err)
 	}
 
-	// redis
-	redisURL := fmt.Sprintf("redis://%s:%s@%s:%s/%s",
-		os.Getenv("REDIS_USER"),
-		os.Getenv("REDIS_PASSWORD"),
-		os.Getenv("REDIS_HOST"),
-		os.Getenv("REDIS_PORT"),
-		os.Getenv("REDIS_DB"),
-	)
+	// LOCATION_STALE_AFTER: seconds without updates after which the driver
+	// isn't returned by Nearest and is removed by the sweeper, 120 by default
+	// LOCATION_SWEEP_INTERVAL: seconds between the sweeps, 30 by default
+	staleAfter, err := durationEnv("LOCATION_STALE_AFTER", 120*time.Second)
 
-	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		level.Error(logger).Log("err", err)
+		return
+	}
+
+	sweepInterval, err := durationEnv("LOCATION_SWEEP_INTERVAL", 30*time.Second)
 
 	if err != nil {
-		level.Error(logger).Log("err", "Failed to connect redis server", err)
+		level.Error(logger).Log("err", err)
 		return
 	}
 
-	rdb := redis.NewClient(opt)
+	// LOCATION_TRACK_INTERVAL: seconds between the recorded locations of the driver, 5 by default
+	// LOCATION_TRACK_RETENTION: seconds the recorded locations are kept, 7 days by default
+	// LOCATION_TRACK_ALL: true records every location, the ride locations only by default
+	trackInterval, err := durationEnv("LOCATION_TRACK_INTERVAL", 5*time.Second)
+
+	if err != nil {
+		level.Error(logger).Log("err", err)
+		return
+	}
+
+	trackRetention, err := durationEnv("LOCATION_TRACK_RETENTION", 7*24*time.Hour)
+
+	if err != nil {
+		level.Error(logger).Log("err", err)
+		return
+	}
+
+	trackAll := os.Getenv("LOCATION_TRACK_ALL") == "true"
+
+	// LOCATION_INDEX: redis (default) or memory, the memory index keeps
+	// the locations in the process for local runs and tests without redis
+	var index service.GeoIndex
+	var track service.TrackStore
+	var pings service.PingStore
+	var removals service.Removals
+
+	switch os.Getenv("LOCATION_INDEX") {
+	case "", "redis":
+		rdb, err := redisClient()
+
+		if err != nil {
+			level.Error(logger).Log("err", "Failed to connect redis server", err)
+			return
+		}
+
+		track = service.NewRedisTrack(rdb, "drivers.track", trackInterval, trackRetention)
+		pings = service.NewRedisPings(rdb, "drivers.last")
+		removals = service.NewRedisRemovals(rdb, "drivers.removed")
+
+		// LOCATION_GEOHASH_PRECISION: geohash length of the cells the drivers
+		// are sharded by e.g. 4 for about 39x20 km, 0 keeps them in one slot
+		precision := 0
+		if v := os.Getenv("LOCATION_GEOHASH_PRECISION"); v != "" {
+			precision, err = strconv.Atoi(v)
+
+			if err != nil || precision < 0 || precision > 12 {
+				level.Error(logger).Log("err", "LOCATION_GEOHASH_PRECISION must be a number from 0 to 12")
+				return
+			}
+		}
+
+		// the {all} hash tag keeps the companion keys in the slot of the geo set
+		if precision == 0 {
+			index = service.NewRedisIndex(rdb, "drivers.location.{all}")
+			break
+		}
+
+		index = service.NewShardedIndex(rdb, "drivers.location", precision, staleAfter)
+	case "memory":
+		level.Info(logger).Log("msg", "Locations are kept in memory, run a single replica")
+		index = service.NewMemoryIndex()
+		track = service.NewMemoryTrack(trackInterval, trackRetention)
+		pings = service.NewMemoryPings()
+		removals = service.NewMemoryRemovals()
+	default:
+		level.Error(logger).Log("err", "LOCATION_INDEX must be redis or memory")
+		return
+	}
+
+	// LOCATION_MAX_SPEED: km/h, the locations implying a faster move
+	// from the last accepted location of the driver are rejected, 250 by default
+	maxSpeed := 250.0
+	if v := os.Getenv("LOCATION_MAX_SPEED"); v != "" {
+		maxSpeed, err = strconv.ParseFloat(v, 64)
+
+		if err != nil || maxSpeed <= 0 {
+			level.Error(logger).Log("err", "LOCATION_MAX_SPEED must be a positive number of km/h")
+			return
+		}
+	}
+
+	rejected := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "location",
+		Name:      "rejected_locations_total",
+		Help:      "Locations rejected by the GPS sanity checks.",
+	}, []string{"reason"})
+
+	filter := service.NewGPSFilter(maxSpeed, pings, rejected)
+	setservice := service.NewService(logger, index, track, filter, removals, staleAfter, trackAll)
+
+	// LOCATION_METRICS_PORT: port of the prometheus /metrics endpoint, 9090 by default
+	metricsPort := os.Getenv("LOCATION_METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9090"
+	}
+
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		level.Info(logger).Log("msg", "Location service metrics started", "port", metricsPort)
+
+		err := http.ListenAndServe(fmt.Sprintf(":%s", metricsPort), mux)
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to serve Location service metrics", "err", err)
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			n, err := setservice.Sweep(context.Background())
+
+			if err != nil {
+				level.Error(logger).Log("msg", "Failed to sweep stale locations", "err", err)
+				continue
+			}
+
+			if n > 0 {
+				level.Info(logger).Log("msg", "Stale locations removed", "count", n)
+			}
+		}
+	}()
 
-	setservice := service.NewService(logger, rdb, "drivers.location")
 	setendpoints := endpoints.MakeEndpoint(setservice)
 	grpcServer := transports.NewGRPCServer(setendpoints, logger)
 
+	// GRPC_TLS_CERT_FILE, GRPC_TLS_KEY_FILE, GRPC_TLS_CA_FILE: see mtls.FromEnv,
+	// with mTLS only drivermanagement writes and removes the driver locations
+	tlsConfig, err := mtls.FromEnv()
+
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to load the gRPC TLS configuration", "err", err)
+		return
+	}
+
+	if !tlsConfig.Mutual() {
+		level.Warn(logger).Log("msg", "gRPC callers aren't authenticated, mTLS isn't configured")
+	}
+
+	serverOpts := tlsConfig.ServerOptions(mtls.Rules{
+		"/pb.Location/Set":             {"drivermanagement"},
+		"/pb.Location/BatchSet":        {"drivermanagement"},
+		"/pb.Location/StreamLocations": {"drivermanagement"},
+		"/pb.Location/Remove":          {"drivermanagement"},
+	})
+
 	port := os.Getenv("GRPC_LOCATION_SRV_PORT")
 	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 
@@ -62,7 +214,7 @@ func main() {
 	}
 
 	go func() {
-		baseServer := grpc.NewServer()
+		baseServer := grpc.NewServer(serverOpts...)
 		reflection.Register(baseServer)
 		pb.RegisterLocationServer(baseServer, grpcServer)
 		level.Info(logger).Log("msg", "Location service GRPC Server started successfully",
@@ -83,3 +235,48 @@ func main() {
 
 	level.Error(logger).Log("exit", sig)
 }
+
+// redisClient connects to the redis cluster when REDIS_CLUSTER_ADDRS
+// has the nodes e.g. redis-master:6379, to REDIS_HOST otherwise
+func redisClient() (redis.UniversalClient, error) {
+	if addrs := os.Getenv("REDIS_CLUSTER_ADDRS"); addrs != "" {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    strings.Split(addrs, ","),
+			Username: os.Getenv("REDIS_USER"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+		}), nil
+	}
+
+	redisURL := fmt.Sprintf("redis://%s:%s@%s:%s/%s",
+		os.Getenv("REDIS_USER"),
+		os.Getenv("REDIS_PASSWORD"),
+		os.Getenv("REDIS_HOST"),
+		os.Getenv("REDIS_PORT"),
+		os.Getenv("REDIS_DB"),
+	)
+
+	opt, err := redis.ParseURL(redisURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return redis.NewClient(opt), nil
+}
+
+// durationEnv reads the seconds from the environment variable
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+
+	if v == "" {
+		return def, nil
+	}
+
+	sec, err := strconv.Atoi(v)
+
+	if err != nil || sec <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number of seconds", name)
+	}
+
+	return time.Duration(sec) * time.Second, nil
+}
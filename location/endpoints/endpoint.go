@@ -2,16 +2,21 @@ package endpoints
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
-	"github.com/go-redis/redis"
 
 	"github.com/jadilet/taximicroservice/location/service"
 )
 
 type Endpoint struct {
-	Set     endpoint.Endpoint
-	Nearest endpoint.Endpoint
+	Set      endpoint.Endpoint
+	Nearest  endpoint.Endpoint
+	Remove   endpoint.Endpoint
+	Get      endpoint.Endpoint
+	BatchSet endpoint.Endpoint
+	InBox    endpoint.Endpoint
+	Track    endpoint.Endpoint
 }
 
 type Point struct {
@@ -20,19 +25,49 @@ type Point struct {
 }
 
 type RequestLocation struct {
+	Key    string
+	P      Point
+	Attrs  map[string]string
+	RideID int
+	Epoch  uint64
+}
+
+type TrackRequest struct {
+	Key    string
+	RideID int
+	From   time.Time
+	To     time.Time
+}
+
+type RequestRemove struct {
+	Key   string
+	Epoch uint64
+}
+
+type RequestGet struct {
 	Key string
-	P   Point
+}
+
+type RequestBatchLocation struct {
+	Locations []RequestLocation
 }
 
 type GeoRequest struct {
-	Lat    float64
-	Lon    float64
-	Radius float64
+	Lat     float64
+	Lon     float64
+	Radius  float64
+	Limit   int
+	Exclude []string
+	Filters map[string]string
+}
+
+type BoxRequest struct {
+	Box   service.Box
+	Limit int
 }
 
 type GeoResponse struct {
-	Locations []redis.GeoLocation
-	Err       string
+	Locations []service.Location
 }
 
 type ResponseLocation struct {
@@ -41,15 +76,21 @@ type ResponseLocation struct {
 
 func MakeEndpoint(s service.Service) Endpoint {
 	return Endpoint{
-		Set:     makeSetEndpoint(s),
-		Nearest: makeNearestEndpoint(s),
+		Set:      makeSetEndpoint(s),
+		Nearest:  makeNearestEndpoint(s),
+		Remove:   makeRemoveEndpoint(s),
+		Get:      makeGetEndpoint(s),
+		BatchSet: makeBatchSetEndpoint(s),
+		InBox:    makeInBoxEndpoint(s),
+		Track:    makeTrackEndpoint(s),
 	}
 }
 
 func makeSetEndpoint(s service.Service) endpoint.Endpoint {
 	return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
 		request := req.(RequestLocation)
-		resp, e := s.Set(ctx, request.Key, request.P.Lat, request.P.Lon)
+		resp, e := s.Set(ctx, service.KeyLocation{Key: request.Key, Lat: request.P.Lat,
+			Lon: request.P.Lon, Attrs: request.Attrs, RideID: request.RideID, Epoch: request.Epoch})
 
 		return resp, e
 	}
@@ -59,12 +100,74 @@ func makeNearestEndpoint(s service.Service) endpoint.Endpoint {
 	return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
 		request := req.(GeoRequest)
 
-		locations, e := s.Nearest(ctx, request.Lon, request.Lat, request.Radius)
+		locations, e := s.Nearest(ctx, service.NearestQuery{
+			Lon:     request.Lon,
+			Lat:     request.Lat,
+			Radius:  request.Radius,
+			Limit:   request.Limit,
+			Exclude: request.Exclude,
+			Filters: request.Filters,
+		})
 
 		if e != nil {
-			return GeoResponse{Locations: locations, Err: e.Error()}, e
+			return nil, e
 		}
 
 		return GeoResponse{Locations: locations}, nil
 	}
 }
+
+func makeInBoxEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
+		request := req.(BoxRequest)
+
+		locations, e := s.InBox(ctx, request.Box, request.Limit)
+
+		if e != nil {
+			return nil, e
+		}
+
+		return GeoResponse{Locations: locations}, nil
+	}
+}
+
+func makeRemoveEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
+		request := req.(RequestRemove)
+		resp, e := s.Remove(ctx, request.Key, request.Epoch)
+
+		return resp, e
+	}
+}
+
+func makeGetEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
+		request := req.(RequestGet)
+
+		return s.Get(ctx, request.Key)
+	}
+}
+
+func makeBatchSetEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
+		request := req.(RequestBatchLocation)
+
+		locations := make([]service.KeyLocation, len(request.Locations))
+		for i, l := range request.Locations {
+			locations[i] = service.KeyLocation{Key: l.Key, Lat: l.P.Lat, Lon: l.P.Lon,
+				Attrs: l.Attrs, RideID: l.RideID, Epoch: l.Epoch}
+		}
+
+		resp, e := s.BatchSet(ctx, locations)
+
+		return resp, e
+	}
+}
+
+func makeTrackEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
+		request := req.(TrackRequest)
+
+		return s.Track(ctx, request.Key, request.RideID, request.From, request.To)
+	}
+}
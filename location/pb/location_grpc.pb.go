@@ -21,6 +21,13 @@ const _ = grpc.SupportPackageIsVersion7
 type LocationClient interface {
 	Set(ctx context.Context, in *RequestLocation, opts ...grpc.CallOption) (*empty.Empty, error)
 	Nearest(ctx context.Context, in *GeoRequest, opts ...grpc.CallOption) (*GeoResponse, error)
+	Remove(ctx context.Context, in *RequestRemove, opts ...grpc.CallOption) (*empty.Empty, error)
+	Get(ctx context.Context, in *RequestGet, opts ...grpc.CallOption) (*GeoLocation, error)
+	// the valid locations are written, InvalidArgument tells how many were rejected
+	BatchSet(ctx context.Context, in *RequestBatchLocation, opts ...grpc.CallOption) (*empty.Empty, error)
+	StreamLocations(ctx context.Context, opts ...grpc.CallOption) (Location_StreamLocationsClient, error)
+	InBox(ctx context.Context, in *BoxRequest, opts ...grpc.CallOption) (*GeoResponse, error)
+	Track(ctx context.Context, in *TrackRequest, opts ...grpc.CallOption) (*TrackResponse, error)
 }
 
 type locationClient struct {
@@ -49,12 +56,98 @@ func (c *locationClient) Nearest(ctx context.Context, in *GeoRequest, opts ...gr
 	return out, nil
 }
 
+func (c *locationClient) Remove(ctx context.Context, in *RequestRemove, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/pb.Location/Remove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationClient) Get(ctx context.Context, in *RequestGet, opts ...grpc.CallOption) (*GeoLocation, error) {
+	out := new(GeoLocation)
+	err := c.cc.Invoke(ctx, "/pb.Location/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationClient) BatchSet(ctx context.Context, in *RequestBatchLocation, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/pb.Location/BatchSet", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationClient) StreamLocations(ctx context.Context, opts ...grpc.CallOption) (Location_StreamLocationsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Location_ServiceDesc.Streams[0], "/pb.Location/StreamLocations", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &locationStreamLocationsClient{stream}
+	return x, nil
+}
+
+type Location_StreamLocationsClient interface {
+	Send(*RequestLocation) error
+	CloseAndRecv() (*StreamSummary, error)
+	grpc.ClientStream
+}
+
+type locationStreamLocationsClient struct {
+	grpc.ClientStream
+}
+
+func (x *locationStreamLocationsClient) Send(m *RequestLocation) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *locationStreamLocationsClient) CloseAndRecv() (*StreamSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StreamSummary)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *locationClient) InBox(ctx context.Context, in *BoxRequest, opts ...grpc.CallOption) (*GeoResponse, error) {
+	out := new(GeoResponse)
+	err := c.cc.Invoke(ctx, "/pb.Location/InBox", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationClient) Track(ctx context.Context, in *TrackRequest, opts ...grpc.CallOption) (*TrackResponse, error) {
+	out := new(TrackResponse)
+	err := c.cc.Invoke(ctx, "/pb.Location/Track", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // LocationServer is the server API for Location service.
 // All implementations must embed UnimplementedLocationServer
 // for forward compatibility
 type LocationServer interface {
 	Set(context.Context, *RequestLocation) (*empty.Empty, error)
 	Nearest(context.Context, *GeoRequest) (*GeoResponse, error)
+	Remove(context.Context, *RequestRemove) (*empty.Empty, error)
+	Get(context.Context, *RequestGet) (*GeoLocation, error)
+	// the valid locations are written, InvalidArgument tells how many were rejected
+	BatchSet(context.Context, *RequestBatchLocation) (*empty.Empty, error)
+	StreamLocations(Location_StreamLocationsServer) error
+	InBox(context.Context, *BoxRequest) (*GeoResponse, error)
+	Track(context.Context, *TrackRequest) (*TrackResponse, error)
 	mustEmbedUnimplementedLocationServer()
 }
 
@@ -68,6 +161,24 @@ func (UnimplementedLocationServer) Set(context.Context, *RequestLocation) (*empt
 func (UnimplementedLocationServer) Nearest(context.Context, *GeoRequest) (*GeoResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Nearest not implemented")
 }
+func (UnimplementedLocationServer) Remove(context.Context, *RequestRemove) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedLocationServer) Get(context.Context, *RequestGet) (*GeoLocation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedLocationServer) BatchSet(context.Context, *RequestBatchLocation) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchSet not implemented")
+}
+func (UnimplementedLocationServer) StreamLocations(Location_StreamLocationsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLocations not implemented")
+}
+func (UnimplementedLocationServer) InBox(context.Context, *BoxRequest) (*GeoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InBox not implemented")
+}
+func (UnimplementedLocationServer) Track(context.Context, *TrackRequest) (*TrackResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Track not implemented")
+}
 func (UnimplementedLocationServer) mustEmbedUnimplementedLocationServer() {}
 
 // UnsafeLocationServer may be embedded to opt out of forward compatibility for this service.
@@ -117,6 +228,122 @@ func _Location_Nearest_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Location_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RequestRemove)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Location/Remove",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServer).Remove(ctx, req.(*RequestRemove))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Location_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RequestGet)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Location/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServer).Get(ctx, req.(*RequestGet))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Location_BatchSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RequestBatchLocation)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServer).BatchSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Location/BatchSet",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServer).BatchSet(ctx, req.(*RequestBatchLocation))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Location_StreamLocations_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LocationServer).StreamLocations(&locationStreamLocationsServer{stream})
+}
+
+type Location_StreamLocationsServer interface {
+	SendAndClose(*StreamSummary) error
+	Recv() (*RequestLocation, error)
+	grpc.ServerStream
+}
+
+type locationStreamLocationsServer struct {
+	grpc.ServerStream
+}
+
+func (x *locationStreamLocationsServer) SendAndClose(m *StreamSummary) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *locationStreamLocationsServer) Recv() (*RequestLocation, error) {
+	m := new(RequestLocation)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Location_InBox_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BoxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServer).InBox(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Location/InBox",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServer).InBox(ctx, req.(*BoxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Location_Track_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TrackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServer).Track(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Location/Track",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServer).Track(ctx, req.(*TrackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Location_ServiceDesc is the grpc.ServiceDesc for Location service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -132,7 +359,33 @@ var Location_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Nearest",
 			Handler:    _Location_Nearest_Handler,
 		},
+		{
+			MethodName: "Remove",
+			Handler:    _Location_Remove_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _Location_Get_Handler,
+		},
+		{
+			MethodName: "BatchSet",
+			Handler:    _Location_BatchSet_Handler,
+		},
+		{
+			MethodName: "InBox",
+			Handler:    _Location_InBox_Handler,
+		},
+		{
+			MethodName: "Track",
+			Handler:    _Location_Track_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLocations",
+			Handler:       _Location_StreamLocations_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "pb/location.proto",
 }
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// GeoIndex stores the driver locations with their last update time and attributes,
+// locations never seen have a zero LastSeen
+type GeoIndex interface {
+	// Add writes the locations seen at the time, empty attributes keep the previous ones
+	Add(ctx context.Context, seen time.Time, locations ...KeyLocation) error
+	Remove(ctx context.Context, key string) error
+	// Radius returns up to count locations around the point sorted by distance ASC,
+	// 0 count returns every location in the radius
+	Radius(ctx context.Context, lon, lat, radius float64, count int) ([]Location, error)
+	// Box returns up to count locations in the box, the nearest to its center first
+	Box(ctx context.Context, box Box, count int) ([]Location, error)
+	Get(ctx context.Context, key string) (Location, error)
+	// RemoveStale removes the locations last seen before the time
+	RemoveStale(ctx context.Context, before time.Time) (int, error)
+}
+
+// kmPerDegree is the length of a degree of latitude, a bit more
+// than the redis one so the search boxes cover the whole area
+const kmPerDegree = 111.32
+
+// earthRadius is the earth radius in km redis uses for the distances
+const earthRadius = 6372.797560856
+
+// distance is the haversine distance between the points in km
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// cellSize is the side of the grid cells in degrees, about 1 km
+const cellSize = 0.01
+
+type cell struct {
+	lat int
+	lon int
+}
+
+func cellOf(lat, lon float64) cell {
+	return cell{int(math.Floor(lat / cellSize)), int(math.Floor(lon / cellSize))}
+}
+
+// memoryIndex keeps the locations in a grid of cells, for local runs
+// and tests, the locations are lost on restart and aren't shared by the replicas
+type memoryIndex struct {
+	mutex     sync.RWMutex
+	locations map[string]Location
+	cells     map[cell]map[string]bool
+}
+
+func NewMemoryIndex() GeoIndex {
+	return &memoryIndex{locations: map[string]Location{}, cells: map[cell]map[string]bool{}}
+}
+
+func (m *memoryIndex) Add(ctx context.Context, seen time.Time, locations ...KeyLocation) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, l := range locations {
+		attrs := l.Attrs
+
+		if old, ok := m.locations[l.Key]; ok {
+			m.unlink(old)
+
+			if len(attrs) == 0 {
+				attrs = old.Attrs
+			}
+		}
+
+		loc := Location{Name: l.Key, Longitude: l.Lon, Latitude: l.Lat, LastSeen: seen, Attrs: attrs}
+		m.locations[l.Key] = loc
+
+		c := cellOf(loc.Latitude, loc.Longitude)
+		if m.cells[c] == nil {
+			m.cells[c] = map[string]bool{}
+		}
+		m.cells[c][l.Key] = true
+	}
+
+	return nil
+}
+
+func (m *memoryIndex) Remove(ctx context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if loc, ok := m.locations[key]; ok {
+		m.unlink(loc)
+		delete(m.locations, key)
+	}
+
+	return nil
+}
+
+// unlink removes the location from its cell
+func (m *memoryIndex) unlink(loc Location) {
+	c := cellOf(loc.Latitude, loc.Longitude)
+	delete(m.cells[c], loc.Name)
+
+	if len(m.cells[c]) == 0 {
+		delete(m.cells, c)
+	}
+}
+
+func (m *memoryIndex) Radius(ctx context.Context, lon, lat, radius float64, count int) ([]Location, error) {
+	// the bounding box of the circle
+	dLat := radius / kmPerDegree
+	dLon := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	box := Box{MinLat: lat - dLat, MinLon: lon - dLon, MaxLat: lat + dLat, MaxLon: lon + dLon}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := []Location{}
+	for _, loc := range m.within(box) {
+		loc.Dist = distance(lat, lon, loc.Latitude, loc.Longitude)
+
+		if loc.Dist <= radius {
+			res = append(res, loc)
+		}
+	}
+
+	return nearestFirst(res, count), nil
+}
+
+func (m *memoryIndex) Box(ctx context.Context, box Box, count int) ([]Location, error) {
+	lat, lon := box.center()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := []Location{}
+	for _, loc := range m.within(box) {
+		if box.contains(loc) {
+			loc.Dist = distance(lat, lon, loc.Latitude, loc.Longitude)
+			res = append(res, loc)
+		}
+	}
+
+	return nearestFirst(res, count), nil
+}
+
+// within returns the locations of the cells the box touches,
+// every location when the box has more cells than locations
+func (m *memoryIndex) within(box Box) []Location {
+	from := cellOf(box.MinLat, box.MinLon)
+	to := cellOf(box.MaxLat, box.MaxLon)
+	res := []Location{}
+
+	if (to.lat-from.lat+1)*(to.lon-from.lon+1) > len(m.locations) {
+		for _, loc := range m.locations {
+			res = append(res, loc)
+		}
+
+		return res
+	}
+
+	for i := from.lat; i <= to.lat; i++ {
+		for j := from.lon; j <= to.lon; j++ {
+			for key := range m.cells[cell{i, j}] {
+				res = append(res, m.locations[key])
+			}
+		}
+	}
+
+	return res
+}
+
+// nearestFirst sorts the locations by distance ASC and keeps count of them, 0 keeps all
+func nearestFirst(res []Location, count int) []Location {
+	sort.Slice(res, func(i, j int) bool { return res[i].Dist < res[j].Dist })
+
+	if count > 0 && len(res) > count {
+		return res[:count]
+	}
+
+	return res
+}
+
+func (m *memoryIndex) Get(ctx context.Context, key string) (Location, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	loc, ok := m.locations[key]
+
+	if !ok {
+		return Location{}, ErrNotFound
+	}
+
+	return loc, nil
+}
+
+func (m *memoryIndex) RemoveStale(ctx context.Context, before time.Time) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	n := 0
+	for key, loc := range m.locations {
+		if loc.LastSeen.Before(before) {
+			m.unlink(loc)
+			delete(m.locations, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// almaty is the point the test drivers are placed around
+const almatyLat, almatyLon = 43.238, 76.945
+
+func names(locations []Location) []string {
+	res := []string{}
+	for _, loc := range locations {
+		res = append(res, loc.Name)
+	}
+
+	return res
+}
+
+func newTestIndex(t *testing.T, seen time.Time, locations ...KeyLocation) GeoIndex {
+	t.Helper()
+
+	index := NewMemoryIndex()
+
+	if err := index.Add(context.Background(), seen, locations...); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	return index
+}
+
+// drivers at about 0.1, 1, 3 and 10 km north of the point
+var testDrivers = []KeyLocation{
+	{Key: "1", Lat: almatyLat + 0.0009, Lon: almatyLon, Attrs: map[string]string{"vehicle_class": "economy"}},
+	{Key: "2", Lat: almatyLat + 0.009, Lon: almatyLon, Attrs: map[string]string{"vehicle_class": "comfort"}},
+	{Key: "3", Lat: almatyLat + 0.027, Lon: almatyLon, Attrs: map[string]string{"vehicle_class": "economy"}},
+	{Key: "4", Lat: almatyLat + 0.09, Lon: almatyLon},
+}
+
+func TestMemoryIndexRadius(t *testing.T) {
+	index := newTestIndex(t, time.Now(), testDrivers...)
+
+	tests := []struct {
+		name   string
+		radius float64
+		count  int
+		want   []string
+	}{
+		{"nearest first", 5, 0, []string{"1", "2", "3"}},
+		{"count", 5, 2, []string{"1", "2"}},
+		{"count over the drivers", 5, 10, []string{"1", "2", "3"}},
+		{"small radius", 0.5, 0, []string{"1"}},
+		{"every driver", 20, 0, []string{"1", "2", "3", "4"}},
+		{"nobody", 0.01, 0, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := index.Radius(context.Background(), almatyLon, almatyLat, tt.radius, tt.count)
+
+			if err != nil {
+				t.Fatalf("Radius: %v", err)
+			}
+
+			if got := names(res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Radius(%v, %d) = %v, want %v", tt.radius, tt.count, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexBox(t *testing.T) {
+	index := newTestIndex(t, time.Now(), testDrivers...)
+
+	tests := []struct {
+		name  string
+		box   Box
+		count int
+		want  []string
+	}{
+		{"inside", Box{almatyLat, almatyLon - 0.01, almatyLat + 0.015, almatyLon + 0.01}, 0,
+			[]string{"2", "1"}},
+		{"nearest to the center", Box{almatyLat, almatyLon - 0.01, almatyLat + 0.1, almatyLon + 0.01}, 1,
+			[]string{"3"}},
+		{"outside", Box{almatyLat - 1, almatyLon - 1, almatyLat - 0.5, almatyLon - 0.5}, 0, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := index.Box(context.Background(), tt.box, tt.count)
+
+			if err != nil {
+				t.Fatalf("Box: %v", err)
+			}
+
+			if got := names(res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Box(%+v, %d) = %v, want %v", tt.box, tt.count, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexGet(t *testing.T) {
+	seen := time.Now()
+	index := newTestIndex(t, seen, testDrivers...)
+
+	tests := []struct {
+		name    string
+		key     string
+		want    Location
+		wantErr error
+	}{
+		{"found", "1", Location{Name: "1", Latitude: testDrivers[0].Lat, Longitude: testDrivers[0].Lon,
+			LastSeen: seen, Attrs: testDrivers[0].Attrs}, nil},
+		{"unknown", "42", Location{}, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := index.Get(context.Background(), tt.key)
+
+			if err != tt.wantErr {
+				t.Fatalf("Get(%q) error = %v, want %v", tt.key, err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get(%q) = %+v, want %+v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexAddMoves(t *testing.T) {
+	index := newTestIndex(t, time.Now(), testDrivers...)
+	ctx := context.Background()
+
+	// the driver 1 goes away without attributes, the previous ones are kept,
+	// the driver 4 comes to the point
+	index.Add(ctx, time.Now(), KeyLocation{Key: "1", Lat: almatyLat + 0.09, Lon: almatyLon},
+		KeyLocation{Key: "4", Lat: almatyLat, Lon: almatyLon, Attrs: map[string]string{"vehicle_class": "business"}})
+
+	res, _ := index.Radius(ctx, almatyLon, almatyLat, 5, 0)
+
+	if got, want := names(res), []string{"4", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Radius after the moves = %v, want %v", got, want)
+	}
+
+	loc, _ := index.Get(ctx, "1")
+
+	if loc.Attrs["vehicle_class"] != "economy" {
+		t.Errorf("attributes of the moved driver = %v, want the previous ones", loc.Attrs)
+	}
+}
+
+func TestMemoryIndexRemove(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want []string
+	}{
+		{"driver", "2", []string{"1", "3"}},
+		{"unknown", "42", []string{"1", "2", "3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newTestIndex(t, time.Now(), testDrivers...)
+			ctx := context.Background()
+
+			if err := index.Remove(ctx, tt.key); err != nil {
+				t.Fatalf("Remove(%q): %v", tt.key, err)
+			}
+
+			res, _ := index.Radius(ctx, almatyLon, almatyLat, 5, 0)
+
+			if got := names(res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Radius after Remove(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+
+			if _, err := index.Get(ctx, tt.key); err != ErrNotFound {
+				t.Errorf("Get(%q) after Remove error = %v, want %v", tt.key, err, ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexRemoveStale(t *testing.T) {
+	now := time.Now()
+	index := newTestIndex(t, now.Add(-time.Hour), testDrivers[:2]...)
+	ctx := context.Background()
+
+	index.Add(ctx, now, testDrivers[2:]...)
+
+	n, err := index.RemoveStale(ctx, now.Add(-time.Minute))
+
+	if err != nil || n != 2 {
+		t.Fatalf("RemoveStale = %d, %v, want 2, nil", n, err)
+	}
+
+	res, _ := index.Radius(ctx, almatyLon, almatyLat, 20, 0)
+
+	if got, want := names(res), []string{"3", "4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Radius after RemoveStale = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Ping is the last accepted location of the driver
+type Ping struct {
+	Lat float64
+	Lon float64
+	At  time.Time
+}
+
+// PingStore keeps the last accepted location of the drivers,
+// the reference of the GPS speed check
+type PingStore interface {
+	// Last returns the last accepted location of the key, false when there is none
+	Last(ctx context.Context, key string) (Ping, bool, error)
+	// Accept makes the location the reference of the key unless a later one is
+	Accept(ctx context.Context, key string, p Ping) error
+	// Prune forgets the locations accepted before the time
+	Prune(ctx context.Context, before time.Time) error
+}
+
+type redisPings struct {
+	rdb redis.UniversalClient
+	key string
+}
+
+// NewRedisPings keeps the last location of every driver in the <key>.{<driver>} hash,
+// shared by the replicas, the hash expires after the reference TTL
+func NewRedisPings(rdb redis.UniversalClient, key string) PingStore {
+	return &redisPings{rdb, key}
+}
+
+func (r redisPings) pingKey(key string) string {
+	return r.key + ".{" + key + "}"
+}
+
+// acceptScript writes the location ARGV[2..3] taken at ARGV[1] ms to the hash KEYS[1]
+// unless it has a later one and expires the hash after ARGV[4] ms
+var acceptScript = redis.NewScript(`
+local at = redis.call('HGET', KEYS[1], 'at')
+if at and tonumber(at) > tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'at', ARGV[1], 'lat', ARGV[2], 'lon', ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+func (r redisPings) Last(ctx context.Context, key string) (Ping, bool, error) {
+	values, err := r.rdb.HMGet(ctx, r.pingKey(key), "lat", "lon", "at").Result()
+
+	if err != nil {
+		return Ping{}, false, err
+	}
+
+	fields := make([]string, len(values))
+	for i, v := range values {
+		fields[i], _ = v.(string)
+	}
+
+	ms, err := strconv.ParseInt(fields[2], 10, 64)
+
+	if err != nil {
+		return Ping{}, false, nil
+	}
+
+	p := Ping{At: time.Unix(0, ms*int64(time.Millisecond))}
+	p.Lat, _ = strconv.ParseFloat(fields[0], 64)
+	p.Lon, _ = strconv.ParseFloat(fields[1], 64)
+
+	return p, true, nil
+}
+
+func (r redisPings) Accept(ctx context.Context, key string, p Ping) error {
+	return acceptScript.Run(ctx, r.rdb, []string{r.pingKey(key)},
+		p.At.UnixNano()/int64(time.Millisecond),
+		strconv.FormatFloat(p.Lat, 'f', -1, 64),
+		strconv.FormatFloat(p.Lon, 'f', -1, 64),
+		referenceTTL.Milliseconds(),
+	).Err()
+}
+
+// Prune does nothing, the hashes expire
+func (r redisPings) Prune(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+// memoryPings keeps the locations in the process for local runs and tests,
+// every replica has its own
+type memoryPings struct {
+	mutex sync.Mutex
+	last  map[string]Ping
+}
+
+func NewMemoryPings() PingStore {
+	return &memoryPings{last: map[string]Ping{}}
+}
+
+func (m *memoryPings) Last(ctx context.Context, key string) (Ping, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	p, ok := m.last[key]
+
+	return p, ok, nil
+}
+
+func (m *memoryPings) Accept(ctx context.Context, key string, p Ping) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if prev, ok := m.last[key]; ok && prev.At.After(p.At) {
+		return nil
+	}
+
+	m.last[key] = p
+
+	return nil
+}
+
+func (m *memoryPings) Prune(ctx context.Context, before time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, p := range m.last {
+		if p.At.Before(before) {
+			delete(m.last, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+type redisIndex struct {
+	rdb redis.UniversalClient
+	key string
+}
+
+// NewRedisIndex keeps the locations in the key geo set, the last
+// update unix times in <key>.seen and the attributes in <key>.attrs.
+// On a redis cluster the key needs a hash tag e.g. drivers.location.{all},
+// the transactions and the sweep script use the three keys together.
+func NewRedisIndex(rdb redis.UniversalClient, key string) GeoIndex {
+	return &redisIndex{rdb, key}
+}
+
+// seenKey is the sorted set of the last update unix time of the drivers
+func (r redisIndex) seenKey() string {
+	return r.key + ".seen"
+}
+
+// attrsKey is the hash of the JSON encoded attributes of the drivers
+func (r redisIndex) attrsKey() string {
+	return r.key + ".attrs"
+}
+
+// Add writes the locations with one GEOADD, one ZADD
+// and one HSET for the locations with attributes
+func (r redisIndex) Add(ctx context.Context, seen time.Time, locations ...KeyLocation) error {
+	now := float64(seen.Unix())
+	geo := make([]*redis.GeoLocation, len(locations))
+	scores := make([]*redis.Z, len(locations))
+	var attrs []interface{}
+	for i, l := range locations {
+		geo[i] = &redis.GeoLocation{Name: l.Key, Longitude: l.Lon, Latitude: l.Lat}
+		scores[i] = &redis.Z{Score: now, Member: l.Key}
+
+		if len(l.Attrs) != 0 {
+			data, err := json.Marshal(l.Attrs)
+
+			if err != nil {
+				return err
+			}
+
+			attrs = append(attrs, l.Key, data)
+		}
+	}
+
+	pipe := r.rdb.TxPipeline()
+	pipe.GeoAdd(ctx, r.key, geo...)
+	pipe.ZAdd(ctx, r.seenKey(), scores...)
+
+	if len(attrs) != 0 {
+		pipe.HSet(ctx, r.attrsKey(), attrs...)
+	}
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (r redisIndex) Remove(ctx context.Context, key string) error {
+	pipe := r.rdb.TxPipeline()
+	pipe.ZRem(ctx, r.key, key)
+	pipe.ZRem(ctx, r.seenKey(), key)
+	pipe.HDel(ctx, r.attrsKey(), key)
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (r redisIndex) Radius(ctx context.Context, lon, lat, radius float64, count int) ([]Location, error) {
+	res, err := r.rdb.GeoSearchLocation(ctx, r.key, &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude:  lon,
+			Latitude:   lat,
+			Radius:     radius,
+			RadiusUnit: "km",
+			Sort:       "ASC",
+			Count:      count,
+		},
+		WithCoord: true,
+		WithDist:  true,
+	}).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.details(ctx, res)
+}
+
+// Box searches the box measured on the sphere, it covers the whole
+// rectangle so a few locations may be outside the coordinates
+func (r redisIndex) Box(ctx context.Context, box Box, count int) ([]Location, error) {
+	// the box is the widest at the latitude nearest to the equator
+	widest := math.Min(math.Abs(box.MinLat), math.Abs(box.MaxLat))
+	if box.MinLat < 0 && box.MaxLat > 0 {
+		widest = 0
+	}
+
+	lat, lon := box.center()
+	res, err := r.rdb.GeoSearchLocation(ctx, r.key, &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude: lon,
+			Latitude:  lat,
+			BoxWidth:  (box.MaxLon - box.MinLon) * kmPerDegree * math.Cos(widest*math.Pi/180),
+			BoxHeight: (box.MaxLat - box.MinLat) * kmPerDegree,
+			BoxUnit:   "km",
+			Sort:      "ASC",
+			Count:     count,
+		},
+		WithCoord: true,
+		WithDist:  true,
+	}).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.details(ctx, res)
+}
+
+// details reads the last seen time and the attributes of the locations
+func (r redisIndex) details(ctx context.Context, res []redis.GeoLocation) ([]Location, error) {
+	if len(res) == 0 {
+		return []Location{}, nil
+	}
+
+	pipe := r.rdb.Pipeline()
+	scores := make([]*redis.FloatCmd, len(res))
+	attrs := make([]*redis.StringCmd, len(res))
+	for i, loc := range res {
+		scores[i] = pipe.ZScore(ctx, r.seenKey(), loc.Name)
+		attrs[i] = pipe.HGet(ctx, r.attrsKey(), loc.Name)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	locations := make([]Location, len(res))
+	for i, loc := range res {
+		locations[i] = Location{
+			Name:      loc.Name,
+			Longitude: loc.Longitude,
+			Latitude:  loc.Latitude,
+			Dist:      loc.Dist,
+			GeoHash:   loc.GeoHash,
+			LastSeen:  lastSeen(scores[i]),
+			Attrs:     decodeAttrs(attrs[i]),
+		}
+	}
+
+	return locations, nil
+}
+
+func (r redisIndex) Get(ctx context.Context, key string) (Location, error) {
+	pipe := r.rdb.Pipeline()
+	pos := pipe.GeoPos(ctx, r.key, key)
+	seen := pipe.ZScore(ctx, r.seenKey(), key)
+	attrs := pipe.HGet(ctx, r.attrsKey(), key)
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return Location{}, err
+	}
+
+	positions, err := pos.Result()
+
+	if err != nil {
+		return Location{}, err
+	}
+
+	if len(positions) == 0 || positions[0] == nil {
+		return Location{}, ErrNotFound
+	}
+
+	return Location{
+		Name:      key,
+		Longitude: positions[0].Longitude,
+		Latitude:  positions[0].Latitude,
+		LastSeen:  lastSeen(seen),
+		Attrs:     decodeAttrs(attrs),
+	}, nil
+}
+
+// sweepScript removes the members of the geo set KEYS[1] and their attributes
+// in KEYS[3] whose last seen time in KEYS[2] is before ARGV[1]
+var sweepScript = redis.NewScript(`
+local stale = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for i = 1, #stale, 500 do
+	local batch = {unpack(stale, i, math.min(i + 499, #stale))}
+	redis.call('ZREM', KEYS[1], unpack(batch))
+	redis.call('ZREM', KEYS[2], unpack(batch))
+	redis.call('HDEL', KEYS[3], unpack(batch))
+end
+return #stale
+`)
+
+func (r redisIndex) RemoveStale(ctx context.Context, before time.Time) (int, error) {
+	max := strconv.FormatInt(before.Unix(), 10)
+
+	return sweepScript.Run(ctx, r.rdb, []string{r.key, r.seenKey(), r.attrsKey()}, max).Int()
+}
+
+// lastSeen reads the last update unix time, zero when the location was never seen
+func lastSeen(cmd *redis.FloatCmd) time.Time {
+	score, err := cmd.Result()
+
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(score), 0)
+}
+
+// decodeAttrs reads the attributes of the driver, nil when the driver has none
+func decodeAttrs(cmd *redis.StringCmd) map[string]string {
+	data, err := cmd.Result()
+
+	if err != nil {
+		return nil
+	}
+
+	var attrs map[string]string
+	if err := json.Unmarshal([]byte(data), &attrs); err != nil {
+		return nil
+	}
+
+	return attrs
+}
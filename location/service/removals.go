@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// removalTTL is how long a removal refuses the earlier locations,
+// far longer than a location waits in the drivermanagement stream
+const removalTTL = 10 * time.Minute
+
+// Removals keeps the epoch of the last removal of the drivers. drivermanagement
+// reads the location of an available driver and sends it later, the locations
+// read before the driver left available have an earlier epoch than the removal.
+type Removals interface {
+	// Record records the removal of the key at the epoch unless a later one is
+	Record(ctx context.Context, key string, epoch uint64) error
+	// Epochs returns the epochs of the last removals of the keys, 0 when there is none
+	Epochs(ctx context.Context, keys []string) ([]uint64, error)
+}
+
+type redisRemovals struct {
+	rdb redis.UniversalClient
+	key string
+}
+
+// NewRedisRemovals keeps the epoch of the last removal of every driver
+// in the <key>.{<driver>} string for the removal TTL
+func NewRedisRemovals(rdb redis.UniversalClient, key string) Removals {
+	return &redisRemovals{rdb, key}
+}
+
+func (r redisRemovals) removalKey(key string) string {
+	return r.key + ".{" + key + "}"
+}
+
+// recordScript sets KEYS[1] to the epoch ARGV[1] unless it has a later one
+// and expires it after ARGV[2] ms
+var recordScript = redis.NewScript(`
+local epoch = redis.call('GET', KEYS[1])
+if epoch and tonumber(epoch) > tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+func (r redisRemovals) Record(ctx context.Context, key string, epoch uint64) error {
+	return recordScript.Run(ctx, r.rdb, []string{r.removalKey(key)},
+		strconv.FormatUint(epoch, 10), removalTTL.Milliseconds()).Err()
+}
+
+// Epochs reads the keys with one pipeline, the cluster client
+// splits it by slot
+func (r redisRemovals) Epochs(ctx context.Context, keys []string) ([]uint64, error) {
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, r.removalKey(key))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	epochs := make([]uint64, len(keys))
+	for i, cmd := range cmds {
+		epochs[i], _ = strconv.ParseUint(cmd.Val(), 10, 64)
+	}
+
+	return epochs, nil
+}
+
+// memoryRemovals keeps the removals in the process for local runs and tests,
+// every replica has its own
+type memoryRemovals struct {
+	mutex  sync.Mutex
+	epochs map[string]uint64
+}
+
+func NewMemoryRemovals() Removals {
+	return &memoryRemovals{epochs: map[string]uint64{}}
+}
+
+func (m *memoryRemovals) Record(ctx context.Context, key string, epoch uint64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if epoch > m.epochs[key] {
+		m.epochs[key] = epoch
+	}
+
+	return nil
+}
+
+func (m *memoryRemovals) Epochs(ctx context.Context, keys []string) ([]uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	epochs := make([]uint64, len(keys))
+	for i, key := range keys {
+		epochs[i] = m.epochs[key]
+	}
+
+	return epochs, nil
+}
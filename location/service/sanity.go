@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// InvalidLocationError is returned for the locations a GPS can't have reported
+type InvalidLocationError struct {
+	Key    string
+	Reason string // out_of_range, null_island or speed
+}
+
+func (e *InvalidLocationError) Error() string {
+	return fmt.Sprintf("invalid location of %s: %s", e.Key, e.Reason)
+}
+
+const (
+	// jumpTolerance is the GPS jitter in km the speed check ignores
+	jumpTolerance = 0.5
+	// referenceTTL is how long the last accepted location stays the reference,
+	// the rejected locations never become the reference, a bad reference rejects
+	// the locations of the driver until it gets old and the next one is accepted
+	referenceTTL = 10 * time.Minute
+)
+
+// GPSFilter rejects the locations out of the coordinate ranges, at null island
+// and the ones too far from the last accepted location of the driver for the time,
+// the speed the check allows grows with the age of the reference location
+type GPSFilter struct {
+	maxSpeed float64 // km/h
+	pings    PingStore
+	rejected metrics.Counter
+}
+
+// NewGPSFilter keeps the last accepted locations in the pings
+// and counts the rejected locations by the reason label
+func NewGPSFilter(maxSpeed float64, pings PingStore, rejected metrics.Counter) *GPSFilter {
+	return &GPSFilter{maxSpeed: maxSpeed, pings: pings, rejected: rejected}
+}
+
+// Check validates the location of the key reported at the time, it returns
+// an *InvalidLocationError for the invalid locations, other errors when
+// the last location of the key can't be read or written
+func (f *GPSFilter) Check(ctx context.Context, key string, lat, lon float64, at time.Time) error {
+	invalid, err := f.check(ctx, key, lat, lon, at)
+
+	if err != nil {
+		return err
+	}
+
+	if invalid != nil {
+		f.rejected.With("reason", invalid.Reason).Add(1)
+		return invalid
+	}
+
+	return nil
+}
+
+func (f *GPSFilter) check(ctx context.Context, key string, lat, lon float64,
+	at time.Time) (*InvalidLocationError, error) {
+	switch {
+	case math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180:
+		return &InvalidLocationError{key, "out_of_range"}, nil
+	case math.Abs(lat) < 1e-4 && math.Abs(lon) < 1e-4:
+		return &InvalidLocationError{key, "null_island"}, nil
+	}
+
+	prev, ok, err := f.pings.Last(ctx, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && at.Sub(prev.At) < referenceTTL {
+		dist := distance(prev.Lat, prev.Lon, lat, lon)
+		hours := math.Max(at.Sub(prev.At).Hours(), time.Second.Hours())
+
+		if dist > jumpTolerance && dist/hours > f.maxSpeed {
+			return &InvalidLocationError{key, "speed"}, nil
+		}
+	}
+
+	return nil, f.pings.Accept(ctx, key, Ping{Lat: lat, Lon: lon, At: at})
+}
+
+// Prune forgets the drivers whose last accepted location is before the time
+func (f *GPSFilter) Prune(ctx context.Context, before time.Time) error {
+	return f.pings.Prune(ctx, before)
+}
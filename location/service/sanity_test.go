@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+func TestGPSFilter(t *testing.T) {
+	start := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	type ping struct {
+		lat, lon float64
+		after    time.Duration // since start
+		reason   string        // empty when accepted
+	}
+
+	tests := []struct {
+		name  string
+		pings []ping
+	}{
+		{"out of range", []ping{
+			{91, almatyLon, 0, "out_of_range"},
+			{almatyLat, -181, 0, "out_of_range"},
+			{math.NaN(), almatyLon, 0, "out_of_range"},
+		}},
+		{"null island", []ping{{0, 0, 0, "null_island"}, {0.00001, -0.00001, 0, "null_island"}}},
+		{"first location", []ping{{almatyLat, almatyLon, 0, ""}}},
+		{"driving", []ping{
+			{almatyLat, almatyLon, 0, ""},
+			// 1 km in a minute, 60 km/h
+			{almatyLat + 0.009, almatyLon, time.Minute, ""},
+		}},
+		{"jitter", []ping{
+			{almatyLat, almatyLon, 0, ""},
+			{almatyLat + 0.003, almatyLon, 0, ""},
+		}},
+		{"jump", []ping{
+			{almatyLat, almatyLon, 0, ""},
+			// 10 km in a minute, 600 km/h
+			{almatyLat + 0.09, almatyLon, time.Minute, "speed"},
+			// the reference is still the first location
+			{almatyLat + 0.009, almatyLon, 2 * time.Minute, ""},
+		}},
+		{"long pause", []ping{
+			{almatyLat, almatyLon, 0, ""},
+			// 10 km in an hour
+			{almatyLat + 0.09, almatyLon, time.Hour, ""},
+		}},
+		// the rejected locations never become the reference
+		{"repeated jumps", []ping{
+			{almatyLat, almatyLon, 0, ""},
+			{almatyLat + 0.9, almatyLon, 10 * time.Second, "speed"},
+			{almatyLat + 0.9, almatyLon, 20 * time.Second, "speed"},
+			{almatyLat + 0.9, almatyLon, 30 * time.Second, "speed"},
+			{almatyLat + 0.9, almatyLon, 40 * time.Second, "speed"},
+			{almatyLat + 0.9, almatyLon, time.Minute, "speed"},
+		}},
+		// 100 km away, the speed the check allows grows with the age of the reference
+		{"bad reference", []ping{
+			{almatyLat + 0.9, almatyLon, 0, ""},
+			{almatyLat, almatyLon, time.Minute, "speed"},
+			{almatyLat, almatyLon, 5 * time.Minute, "speed"},
+			{almatyLat, almatyLon, referenceTTL - time.Second, "speed"},
+			{almatyLat, almatyLon, referenceTTL, ""},
+			{almatyLat + 0.9, almatyLon, referenceTTL + time.Minute, "speed"},
+		}},
+		{"reference decays", []ping{
+			{almatyLat, almatyLon, 0, ""},
+			// 5 km in a minute is too fast, in 5 minutes it isn't
+			{almatyLat + 0.045, almatyLon, time.Minute, "speed"},
+			{almatyLat + 0.045, almatyLon, 5 * time.Minute, ""},
+		}},
+		{"late location", []ping{
+			{almatyLat, almatyLon, time.Minute, ""},
+			{almatyLat + 0.003, almatyLon, 0, ""},
+			// the reference is still the later location
+			{almatyLat + 0.009, almatyLon, time.Minute + 10*time.Second, "speed"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewGPSFilter(200, NewMemoryPings(), discard.NewCounter())
+
+			for i, p := range tt.pings {
+				err := f.Check(context.Background(), "1", p.lat, p.lon, start.Add(p.after))
+
+				if p.reason == "" {
+					if err != nil {
+						t.Errorf("ping %d: Check = %v, want accepted", i, err)
+					}
+					continue
+				}
+
+				invalid, ok := err.(*InvalidLocationError)
+
+				if !ok || invalid.Reason != p.reason {
+					t.Errorf("ping %d: Check = %v, want the %s error", i, err, p.reason)
+				}
+			}
+		})
+	}
+}
+
+func TestGPSFilterKeys(t *testing.T) {
+	f := NewGPSFilter(200, NewMemoryPings(), discard.NewCounter())
+	ctx := context.Background()
+	start := time.Now()
+
+	f.Check(ctx, "1", almatyLat, almatyLon, start)
+
+	// another driver far away isn't compared to the first one
+	if err := f.Check(ctx, "2", almatyLat+1, almatyLon, start); err != nil {
+		t.Errorf("Check of another driver = %v, want accepted", err)
+	}
+}
+
+// the replicas sharing the pings check the locations against the same reference
+func TestGPSFilterSharedPings(t *testing.T) {
+	pings := NewMemoryPings()
+	first := NewGPSFilter(200, pings, discard.NewCounter())
+	second := NewGPSFilter(200, pings, discard.NewCounter())
+	ctx := context.Background()
+	start := time.Now()
+
+	if err := first.Check(ctx, "1", almatyLat, almatyLon, start); err != nil {
+		t.Fatalf("Check = %v, want accepted", err)
+	}
+
+	err := second.Check(ctx, "1", almatyLat+0.9, almatyLon, start.Add(time.Minute))
+
+	if invalid, ok := err.(*InvalidLocationError); !ok || invalid.Reason != "speed" {
+		t.Errorf("Check of the other replica = %v, want the speed error", err)
+	}
+}
+
+func TestMemoryPingsPrune(t *testing.T) {
+	pings := NewMemoryPings()
+	ctx := context.Background()
+	now := time.Now()
+
+	pings.Accept(ctx, "1", Ping{Lat: almatyLat, Lon: almatyLon, At: now.Add(-time.Hour)})
+	pings.Accept(ctx, "2", Ping{Lat: almatyLat, Lon: almatyLon, At: now})
+
+	if err := pings.Prune(ctx, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+
+	for key, want := range map[string]bool{"1": false, "2": true} {
+		if _, ok, _ := pings.Last(ctx, key); ok != want {
+			t.Errorf("Last(%q) after Prune found %v, want %v", key, ok, want)
+		}
+	}
+}
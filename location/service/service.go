@@ -2,59 +2,378 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/go-kit/kit/log"
-	"github.com/go-redis/redis"
 	"github.com/golang/protobuf/ptypes/empty"
 )
 
+var ErrNotFound = errors.New("location not found")
+
+// RejectedLocationsError is returned by BatchSet when some of the
+// locations were invalid, the valid ones are written anyway
+type RejectedLocationsError struct {
+	Rejected int
+	Total    int
+}
+
+func (e *RejectedLocationsError) Error() string {
+	return fmt.Sprintf("%d of %d locations rejected", e.Rejected, e.Total)
+}
+
 type service struct {
-	logger log.Logger
-	rdb    *redis.Client
-	rdbKey string
+	logger     log.Logger
+	index      GeoIndex
+	track      TrackStore
+	filter     *GPSFilter
+	removals   Removals
+	staleAfter time.Duration
+	trackAll   bool
+}
+
+// Location is a driver location with the time of the last update
+type Location struct {
+	Name      string
+	Longitude float64
+	Latitude  float64
+	Dist      float64 // km from the query point
+	GeoHash   int64
+	LastSeen  time.Time
+	Attrs     map[string]string
+}
+
+// KeyLocation is a location update of the key
+type KeyLocation struct {
+	Key    string
+	Lat    float64
+	Lon    float64
+	Attrs  map[string]string
+	RideID int    // the ride of the driver, the location only goes to the track
+	Epoch  uint64 // the availability epoch of the driver when the location was read
+}
+
+// Track is the recorded route of the driver
+type Track struct {
+	Points   []TrackPoint
+	Distance float64 // km along the points
+}
+
+// NearestQuery selects the drivers around the point
+type NearestQuery struct {
+	Lon     float64
+	Lat     float64
+	Radius  float64
+	Limit   int               // 0 returns every driver in the radius
+	Exclude []string          // keys left out e.g. drivers who declined the ride
+	Filters map[string]string // attributes the drivers must have e.g. vehicle_class
+}
+
+// Box is a rectangle on the map e.g. the passenger map viewport
+type Box struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
 }
 
+// contains tells whether the location is inside the box
+func (b Box) contains(loc Location) bool {
+	return loc.Latitude >= b.MinLat && loc.Latitude <= b.MaxLat &&
+		loc.Longitude >= b.MinLon && loc.Longitude <= b.MaxLon
+}
+
+// center is the middle point of the box
+func (b Box) center() (lat, lon float64) {
+	return (b.MinLat + b.MaxLat) / 2, (b.MinLon + b.MaxLon) / 2
+}
+
+// maxInBox caps the drivers returned by InBox, enough for a map
+const maxInBox = 500
+
 // Service interface describe  a service that set locations
 type Service interface {
-	Set(ctx context.Context, key string, lat, lon float64) (*empty.Empty, error)
-	Nearest(ctx context.Context, lon, lat, radius float64) ([]redis.GeoLocation, error)
+	Set(ctx context.Context, location KeyLocation) (*empty.Empty, error)
+	Nearest(ctx context.Context, q NearestQuery) ([]Location, error)
+	InBox(ctx context.Context, box Box, limit int) ([]Location, error)
+	Remove(ctx context.Context, key string, epoch uint64) (*empty.Empty, error)
+	Get(ctx context.Context, key string) (Location, error)
+	BatchSet(ctx context.Context, locations []KeyLocation) (*empty.Empty, error)
+	Sweep(ctx context.Context) (int, error)
+	Track(ctx context.Context, key string, rideID int, from, to time.Time) (Track, error)
 }
 
-func NewService(log log.Logger, rdb *redis.Client, key string) Service {
-	return &service{log, rdb, key}
+// NewService returns the location service, locations older
+// than staleAfter aren't returned by Nearest and are removed by Sweep,
+// the track records the locations of the rides, every location with trackAll,
+// the removals refuse the locations read before the driver was removed
+func NewService(log log.Logger, index GeoIndex, track TrackStore, filter *GPSFilter, removals Removals,
+	staleAfter time.Duration, trackAll bool) Service {
+	return &service{log, index, track, filter, removals, staleAfter, trackAll}
 }
 
-func (s service) Nearest(ctx context.Context, lon, lat, radius float64) ([]redis.GeoLocation, error) {
+func (s service) Nearest(ctx context.Context, q NearestQuery) ([]Location, error) {
+	exclude := make(map[string]bool, len(q.Exclude))
+	for _, key := range q.Exclude {
+		exclude[key] = true
+	}
+
+	// the excluded, stale and filtered out drivers are dropped after the query,
+	// ask for more until there are enough of them or the radius has no more drivers
+	count := 0
+	if q.Limit > 0 {
+		count = q.Limit + len(q.Exclude)
+	}
 
-	res, err := s.rdb.GeoRadius(ctx, s.rdbKey, lon, lat, &redis.GeoRadiusQuery{
-		Unit:      "km",
-		WithDist:  true,
-		Radius:    radius,
-		WithCoord: true,
-		Sort:      "ASC",
-	}).Result()
+	for {
+		res, err := s.index.Radius(ctx, q.Lon, q.Lat, q.Radius, count)
+
+		if err != nil {
+			return []Location{}, err
+		}
+
+		locations := s.fresh(res, exclude, q.Filters)
+
+		if count == 0 || len(res) < count || len(locations) >= q.Limit {
+			if q.Limit > 0 && len(locations) > q.Limit {
+				locations = locations[:q.Limit]
+			}
+
+			return locations, nil
+		}
+
+		count *= 2
+	}
+}
+
+// InBox returns the drivers inside the box, limit caps them
+// to the ones nearest to the box center
+func (s service) InBox(ctx context.Context, box Box, limit int) ([]Location, error) {
+	if limit <= 0 || limit > maxInBox {
+		limit = maxInBox
+	}
+
+	res, err := s.index.Box(ctx, box, limit)
 
 	if err != nil {
-		return []redis.GeoLocation{}, err
+		return []Location{}, err
+	}
+
+	// the index may cover a bit more than the box, keep the drivers inside the coordinates
+	inside := res[:0]
+	for _, loc := range res {
+		if box.contains(loc) {
+			inside = append(inside, loc)
+		}
 	}
 
-	return res, nil
+	return s.fresh(inside, nil, nil), nil
 }
 
-func (s service) Set(ctx context.Context, key string, lat, lon float64) (*empty.Empty, error) {
+// fresh drops the excluded locations, the ones which weren't
+// updated for staleAfter and the ones without the filters attributes
+func (s service) fresh(res []Location, exclude map[string]bool, filters map[string]string) []Location {
+	threshold := time.Now().Add(-s.staleAfter)
+	locations := []Location{}
+
+	for _, loc := range res {
+		// never seen: indexed before the last seen time was tracked
+		if exclude[loc.Name] || loc.LastSeen.IsZero() || loc.LastSeen.Before(threshold) {
+			continue
+		}
+
+		if !matches(loc.Attrs, filters) {
+			continue
+		}
+
+		locations = append(locations, loc)
+	}
+
+	return locations
+}
+
+// matches tells whether the attributes have every filter value
+func matches(attrs, filters map[string]string) bool {
+	for k, v := range filters {
+		if attrs[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s service) Set(ctx context.Context, location KeyLocation) (*empty.Empty, error) {
 	var emp empty.Empty
 
-	err := s.rdb.GeoAdd(ctx, s.rdbKey, &redis.GeoLocation{
-		Name:      key,
-		Longitude: lon,
-		Latitude:  lat,
-		Dist:      0,
-		GeoHash:   0,
-	}).Err()
+	invalid, err := s.write(ctx, location)
 
 	if err != nil {
 		return &emp, err
 	}
 
+	if len(invalid) != 0 {
+		return &emp, invalid[0]
+	}
+
 	return &emp, nil
 }
+
+// write indexes the valid locations without a ride and records
+// the track of the rides, of every location with trackAll
+func (s service) write(ctx context.Context, locations ...KeyLocation) ([]error, error) {
+	now := time.Now()
+
+	var invalid []error
+	var indexed []KeyLocation
+	var points []TrackPoint
+	for _, l := range locations {
+		if err := s.filter.Check(ctx, l.Key, l.Lat, l.Lon, now); err != nil {
+			var invalidErr *InvalidLocationError
+
+			if !errors.As(err, &invalidErr) {
+				return invalid, err
+			}
+
+			invalid = append(invalid, err)
+			continue
+		}
+
+		if l.RideID == 0 {
+			indexed = append(indexed, l)
+		}
+
+		if l.RideID != 0 || s.trackAll {
+			points = append(points, TrackPoint{Key: l.Key, Lat: l.Lat, Lon: l.Lon, RideID: l.RideID, At: now})
+		}
+	}
+
+	if len(indexed) != 0 {
+		if err := s.index.Add(ctx, now, indexed...); err != nil {
+			return invalid, err
+		}
+
+		if err := s.unindexRemoved(ctx, indexed); err != nil {
+			return invalid, err
+		}
+	}
+
+	if len(points) != 0 {
+		return invalid, s.track.Append(ctx, points...)
+	}
+
+	return invalid, nil
+}
+
+// unindexRemoved removes the drivers whose locations are of an epoch before their
+// last removal. The removals are checked after the locations are indexed so a removal
+// recorded meanwhile is seen either here or by the index removal following it.
+func (s service) unindexRemoved(ctx context.Context, locations []KeyLocation) error {
+	keys := make([]string, len(locations))
+	for i, l := range locations {
+		keys[i] = l.Key
+	}
+
+	epochs, err := s.removals.Epochs(ctx, keys)
+
+	if err != nil {
+		return err
+	}
+
+	for i, l := range locations {
+		if l.Epoch >= epochs[i] {
+			continue
+		}
+
+		s.logger.Log("msg", "Location read before the driver was removed", "key", l.Key,
+			"epoch", l.Epoch, "removed", epochs[i])
+
+		if err := s.index.Remove(ctx, l.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Track returns the points of the driver recorded in [from, to],
+// only the points of the ride when rideID isn't 0
+func (s service) Track(ctx context.Context, key string, rideID int, from, to time.Time) (Track, error) {
+	if from.IsZero() {
+		from = time.Unix(0, 0)
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	points, err := s.track.Range(ctx, key, from, to)
+
+	if err != nil {
+		return Track{}, err
+	}
+
+	track := Track{Points: []TrackPoint{}}
+	for _, p := range points {
+		if rideID != 0 && p.RideID != rideID {
+			continue
+		}
+
+		if n := len(track.Points); n > 0 {
+			last := track.Points[n-1]
+			track.Distance += distance(last.Lat, last.Lon, p.Lat, p.Lon)
+		}
+
+		track.Points = append(track.Points, p)
+	}
+
+	return track, nil
+}
+
+// Remove removes the driver from the index, the locations of the earlier
+// epochs arriving later are refused
+func (s service) Remove(ctx context.Context, key string, epoch uint64) (*empty.Empty, error) {
+	var emp empty.Empty
+
+	// recorded first, see unindexRemoved
+	if err := s.removals.Record(ctx, key, epoch); err != nil {
+		return &emp, err
+	}
+
+	if err := s.index.Remove(ctx, key); err != nil {
+		return &emp, err
+	}
+
+	return &emp, nil
+}
+
+func (s service) Get(ctx context.Context, key string) (Location, error) {
+	return s.index.Get(ctx, key)
+}
+
+// BatchSet writes the valid locations in one index call
+func (s service) BatchSet(ctx context.Context, locations []KeyLocation) (*empty.Empty, error) {
+	var emp empty.Empty
+
+	invalid, err := s.write(ctx, locations...)
+
+	if err != nil {
+		return &emp, err
+	}
+
+	if len(invalid) != 0 {
+		return &emp, &RejectedLocationsError{Rejected: len(invalid), Total: len(locations)}
+	}
+
+	return &emp, nil
+}
+
+// Sweep removes the drivers which weren't updated for staleAfter
+func (s service) Sweep(ctx context.Context) (int, error) {
+	if err := s.filter.Prune(ctx, time.Now().Add(-s.staleAfter)); err != nil {
+		return 0, err
+	}
+
+	return s.index.RemoveStale(ctx, time.Now().Add(-s.staleAfter))
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+func newTestService(index GeoIndex) Service {
+	return NewService(log.NewNopLogger(), index, NewMemoryTrack(time.Minute, time.Hour),
+		NewGPSFilter(200, NewMemoryPings(), discard.NewCounter()), NewMemoryRemovals(), 5*time.Minute, false)
+}
+
+func TestNearest(t *testing.T) {
+	index := newTestIndex(t, time.Now(), testDrivers...)
+	// the stale driver is the nearest one
+	index.Add(context.Background(), time.Now().Add(-time.Hour),
+		KeyLocation{Key: "stale", Lat: almatyLat, Lon: almatyLon})
+	s := newTestService(index)
+
+	tests := []struct {
+		name string
+		q    NearestQuery
+		want []string
+	}{
+		{"every fresh driver", NearestQuery{Radius: 20}, []string{"1", "2", "3", "4"}},
+		{"limit", NearestQuery{Radius: 20, Limit: 2}, []string{"1", "2"}},
+		{"limit over the drivers", NearestQuery{Radius: 5, Limit: 10}, []string{"1", "2", "3"}},
+		{"exclude", NearestQuery{Radius: 20, Exclude: []string{"1", "3"}}, []string{"2", "4"}},
+		{"exclude and limit", NearestQuery{Radius: 20, Limit: 2, Exclude: []string{"1"}}, []string{"2", "3"}},
+		// the excluded and the stale drivers take the first results, the query asks for more
+		{"limit after the dropped drivers", NearestQuery{Radius: 20, Limit: 1, Exclude: []string{"1", "2"}},
+			[]string{"3"}},
+		{"exclude everybody", NearestQuery{Radius: 5, Limit: 2, Exclude: []string{"1", "2", "3"}}, []string{}},
+		{"filters", NearestQuery{Radius: 20, Filters: map[string]string{"vehicle_class": "economy"}},
+			[]string{"1", "3"}},
+		{"filters and limit", NearestQuery{Radius: 20, Limit: 1,
+			Filters: map[string]string{"vehicle_class": "comfort"}}, []string{"2"}},
+		{"unknown class", NearestQuery{Radius: 20, Filters: map[string]string{"vehicle_class": "business"}},
+			[]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.q.Lat, tt.q.Lon = almatyLat, almatyLon
+
+			res, err := s.Nearest(context.Background(), tt.q)
+
+			if err != nil {
+				t.Fatalf("Nearest: %v", err)
+			}
+
+			if got := names(res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Nearest(%+v) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInBox(t *testing.T) {
+	s := newTestService(newTestIndex(t, time.Now(), testDrivers...))
+	box := Box{almatyLat, almatyLon - 0.01, almatyLat + 0.1, almatyLon + 0.01}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		{"every driver", 0, []string{"3", "4", "2", "1"}},
+		{"limit", 2, []string{"3", "4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.InBox(context.Background(), box, tt.limit)
+
+			if err != nil {
+				t.Fatalf("InBox: %v", err)
+			}
+
+			if got := names(res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("InBox(%d) = %v, want %v", tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetRejectsInvalidLocations(t *testing.T) {
+	s := newTestService(NewMemoryIndex())
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		loc    KeyLocation
+		reason string
+	}{
+		{"valid", KeyLocation{Key: "1", Lat: almatyLat, Lon: almatyLon}, ""},
+		{"out of range", KeyLocation{Key: "2", Lat: 91, Lon: almatyLon}, "out_of_range"},
+		{"null island", KeyLocation{Key: "3"}, "null_island"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Set(ctx, tt.loc)
+			_, getErr := s.Get(ctx, tt.loc.Key)
+
+			if tt.reason == "" {
+				if err != nil || getErr != nil {
+					t.Errorf("Set(%+v) = %v, Get error %v, want the location indexed", tt.loc, err, getErr)
+				}
+				return
+			}
+
+			invalid, ok := err.(*InvalidLocationError)
+
+			if !ok || invalid.Reason != tt.reason {
+				t.Errorf("Set(%+v) = %v, want the %s error", tt.loc, err, tt.reason)
+			}
+
+			if getErr != ErrNotFound {
+				t.Errorf("Get(%q) error = %v, want %v", tt.loc.Key, getErr, ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	s := newTestService(newTestIndex(t, time.Now(), testDrivers...))
+	ctx := context.Background()
+
+	if _, err := s.Remove(ctx, "1", 0); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	if _, err := s.Get(ctx, "1"); err != ErrNotFound {
+		t.Errorf("Get after Remove error = %v, want %v", err, ErrNotFound)
+	}
+
+	res, _ := s.Nearest(ctx, NearestQuery{Lat: almatyLat, Lon: almatyLon, Radius: 5})
+
+	if got, want := names(res), []string{"2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Nearest after Remove = %v, want %v", got, want)
+	}
+}
+
+func TestRemoveRefusesEarlierEpochs(t *testing.T) {
+	s := newTestService(NewMemoryIndex())
+	ctx := context.Background()
+	loc := KeyLocation{Key: "1", Lat: almatyLat, Lon: almatyLon, Epoch: 1}
+
+	if _, err := s.Remove(ctx, "1", 2); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		epoch   uint64
+		indexed bool
+	}{
+		// read before the removal, arriving after it
+		{"earlier epoch", 1, false},
+		{"removal epoch", 2, true},
+		{"later epoch", 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc.Epoch = tt.epoch
+
+			if _, err := s.Set(ctx, loc); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			_, err := s.Get(ctx, "1")
+
+			if indexed := err == nil; indexed != tt.indexed {
+				t.Errorf("Set with epoch %d indexed %v, want %v (Get error %v)", tt.epoch, indexed, tt.indexed, err)
+			}
+
+			if _, err := s.Remove(ctx, "1", 2); err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+		})
+	}
+}
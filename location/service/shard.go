@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// maxCells caps the cells a search may cover
+const maxCells = 256
+
+var ErrTooManyCells = errors.New("search area covers too many cells")
+
+// shardedIndex partitions the drivers by geohash cell, every cell is a redis index
+// with the cell in a hash tag e.g. drivers.location.{u8vx}, so the keys of the cell
+// share the redis cluster slot and the cells spread over the cluster
+type shardedIndex struct {
+	rdb       redis.UniversalClient
+	key       string
+	precision int
+	ttl       time.Duration
+}
+
+// NewShardedIndex shards the locations by the geohash of the precision length,
+// <key>.cell.{<driver>} keeps the cell of the driver for ttl after the last update
+// and <key>.cells the cells for the sweeps
+func NewShardedIndex(rdb redis.UniversalClient, key string, precision int, ttl time.Duration) GeoIndex {
+	return &shardedIndex{rdb, key, precision, ttl}
+}
+
+func (s shardedIndex) cell(hash string) redisIndex {
+	return redisIndex{s.rdb, s.key + ".{" + hash + "}"}
+}
+
+func (s shardedIndex) cellsKey() string {
+	return s.key + ".cells"
+}
+
+func (s shardedIndex) driverCellKey(key string) string {
+	return s.key + ".cell.{" + key + "}"
+}
+
+func (s shardedIndex) Add(ctx context.Context, seen time.Time, locations ...KeyLocation) error {
+	// the last location of the driver in the batch wins, a driver is in one cell only
+	last := make(map[string]int, len(locations))
+	for i, l := range locations {
+		last[l.Key] = i
+	}
+
+	unique := locations[:0:0]
+	for i, l := range locations {
+		if last[l.Key] == i {
+			unique = append(unique, l)
+		}
+	}
+	locations = unique
+
+	pipe := s.rdb.Pipeline()
+	current := make([]*redis.StringCmd, len(locations))
+	for i, l := range locations {
+		current[i] = pipe.Get(ctx, s.driverCellKey(l.Key))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err
+	}
+
+	cells := map[string][]KeyLocation{}
+	moved := map[string]string{} // driver key: the cell it left
+	var added []interface{}
+	for i, l := range locations {
+		hash := geohash(l.Lat, l.Lon, s.precision)
+		cells[hash] = append(cells[hash], l)
+
+		old, err := current[i].Result()
+
+		if err == nil && old == hash {
+			continue
+		}
+
+		if err == nil {
+			moved[l.Key] = old
+		}
+
+		added = append(added, hash)
+	}
+
+	for hash, locs := range cells {
+		if err := s.cell(hash).Add(ctx, seen, locs...); err != nil {
+			return err
+		}
+	}
+
+	for key, old := range moved {
+		if err := s.cell(old).Remove(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	pipe = s.rdb.Pipeline()
+	for hash, locs := range cells {
+		for _, l := range locs {
+			pipe.Set(ctx, s.driverCellKey(l.Key), hash, s.ttl)
+		}
+	}
+
+	if len(added) != 0 {
+		pipe.SAdd(ctx, s.cellsKey(), added...)
+	}
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (s shardedIndex) Remove(ctx context.Context, key string) error {
+	hash, err := s.rdb.Get(ctx, s.driverCellKey(key)).Result()
+
+	if err == redis.Nil {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := s.cell(hash).Remove(ctx, key); err != nil {
+		return err
+	}
+
+	return s.rdb.Del(ctx, s.driverCellKey(key)).Err()
+}
+
+func (s shardedIndex) Get(ctx context.Context, key string) (Location, error) {
+	hash, err := s.rdb.Get(ctx, s.driverCellKey(key)).Result()
+
+	if err == redis.Nil {
+		return Location{}, ErrNotFound
+	}
+
+	if err != nil {
+		return Location{}, err
+	}
+
+	return s.cell(hash).Get(ctx, key)
+}
+
+func (s shardedIndex) Radius(ctx context.Context, lon, lat, radius float64, count int) ([]Location, error) {
+	// the bounding box of the circle, it takes in the neighbour cells
+	dLat := radius / kmPerDegree
+	dLon := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	box := Box{MinLat: lat - dLat, MinLon: lon - dLon, MaxLat: lat + dLat, MaxLon: lon + dLon}
+
+	return s.search(box, count, func(cell redisIndex) ([]Location, error) {
+		return cell.Radius(ctx, lon, lat, radius, count)
+	})
+}
+
+func (s shardedIndex) Box(ctx context.Context, box Box, count int) ([]Location, error) {
+	return s.search(box, count, func(cell redisIndex) ([]Location, error) {
+		return cell.Box(ctx, box, count)
+	})
+}
+
+// search queries the cells covering the box at the same time
+// and merges their locations by distance
+func (s shardedIndex) search(box Box, count int, query func(cell redisIndex) ([]Location, error)) ([]Location, error) {
+	hashes, err := coveringCells(box, s.precision)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]Location, len(hashes))
+	errs := make([]error, len(hashes))
+	for i, hash := range hashes {
+		wg.Add(1)
+		go func(i int, hash string) {
+			defer wg.Done()
+			results[i], errs[i] = query(s.cell(hash))
+		}(i, hash)
+	}
+	wg.Wait()
+
+	res := []Location{}
+	for i := range hashes {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+
+		res = append(res, results[i]...)
+	}
+
+	return nearestFirst(res, count), nil
+}
+
+func (s shardedIndex) RemoveStale(ctx context.Context, before time.Time) (int, error) {
+	hashes, err := s.rdb.SMembers(ctx, s.cellsKey()).Result()
+
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, hash := range hashes {
+		n, err := s.cell(hash).RemoveStale(ctx, before)
+
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+	}
+
+	return total, nil
+}
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohash encodes the point to the geohash of the precision length
+func geohash(lat, lon float64, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+	hash := make([]byte, 0, precision)
+	bit, ch, even := 0, 0, true
+
+	for len(hash) < precision {
+		if even {
+			mid := (minLon + maxLon) / 2
+			if lon >= mid {
+				ch |= 1 << (4 - bit)
+				minLon = mid
+			} else {
+				maxLon = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				ch |= 1 << (4 - bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+
+		even = !even
+
+		if bit < 4 {
+			bit++
+			continue
+		}
+
+		hash = append(hash, geohashBase32[ch])
+		bit, ch = 0, 0
+	}
+
+	return string(hash)
+}
+
+// coveringCells returns the geohash cells of the precision the box touches
+func coveringCells(box Box, precision int) ([]string, error) {
+	bits := 5 * precision
+	latStep := 180 / math.Exp2(float64(bits/2))
+	lonStep := 360 / math.Exp2(float64((bits+1)/2))
+
+	minLat, maxLat := math.Max(box.MinLat, -90), math.Min(box.MaxLat, 90)
+	fromLat := math.Floor(minLat/latStep) * latStep
+	fromLon := math.Floor(box.MinLon/lonStep) * lonStep
+
+	rows := int(math.Ceil((maxLat - fromLat) / latStep))
+	cols := int(math.Ceil((box.MaxLon - fromLon) / lonStep))
+	if rows < 1 {
+		rows = 1
+	}
+	if cols < 1 {
+		cols = 1
+	}
+
+	if rows*cols > maxCells {
+		return nil, ErrTooManyCells
+	}
+
+	seen := map[string]bool{}
+	hashes := []string{}
+	for i := 0; i < rows; i++ {
+		// the cell centers, the longitude wraps around the antimeridian
+		lat := math.Min(fromLat+(float64(i)+0.5)*latStep, 90)
+
+		for j := 0; j < cols; j++ {
+			lon := math.Mod(fromLon+(float64(j)+0.5)*lonStep+540, 360) - 180
+			hash := geohash(lat, lon, precision)
+
+			if !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+
+	sort.Strings(hashes)
+
+	return hashes, nil
+}
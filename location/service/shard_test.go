@@ -0,0 +1,85 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGeohash(t *testing.T) {
+	tests := []struct {
+		lat, lon  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{42.6, -5.6, 5, "ezs42"},
+		{-25.382708, -49.265506, 8, "6gkzwgjz"},
+		{almatyLat, almatyLon, 4, "txwt"},
+		{0, 0, 1, "s"},
+		{-90, -180, 2, "00"},
+		{90, 180, 2, "zz"},
+	}
+
+	for _, tt := range tests {
+		if got := geohash(tt.lat, tt.lon, tt.precision); got != tt.want {
+			t.Errorf("geohash(%v, %v, %d) = %q, want %q", tt.lat, tt.lon, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestCoveringCells(t *testing.T) {
+	tests := []struct {
+		name      string
+		box       Box
+		precision int
+		want      []string
+		wantErr   error
+	}{
+		{"inside a cell", Box{almatyLat - 0.01, almatyLon, almatyLat + 0.001, almatyLon + 0.01}, 4,
+			[]string{"txwt"}, nil},
+		{"a point", Box{almatyLat, almatyLon, almatyLat, almatyLon}, 4, []string{"txwt"}, nil},
+		{"neighbour cells", Box{44.9, 44.9, 45.1, 45.1}, 1, []string{"s", "t", "u", "v"}, nil},
+		{"the world", Box{-90, -180, 90, 180}, 1, strings.Split(geohashBase32, ""), nil},
+		{"past the poles", Box{80, 0, 100, 1}, 1, []string{"u"}, nil},
+		{"across the antimeridian", Box{1, 179, 2, 181}, 1, []string{"8", "x"}, nil},
+		{"too many cells", Box{-90, -180, 90, 180}, 3, nil, ErrTooManyCells},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := coveringCells(tt.box, tt.precision)
+
+			if err != tt.wantErr {
+				t.Fatalf("coveringCells error = %v, want %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coveringCells(%+v, %d) = %v, want %v", tt.box, tt.precision, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoveringCellsContainPoints(t *testing.T) {
+	box := Box{almatyLat - 0.05, almatyLon - 0.05, almatyLat + 0.05, almatyLon + 0.05}
+
+	cells, err := coveringCells(box, 5)
+
+	if err != nil {
+		t.Fatalf("coveringCells: %v", err)
+	}
+
+	covered := map[string]bool{}
+	for _, c := range cells {
+		covered[c] = true
+	}
+
+	for _, lat := range []float64{box.MinLat, almatyLat, box.MaxLat} {
+		for _, lon := range []float64{box.MinLon, almatyLon, box.MaxLon} {
+			if hash := geohash(lat, lon, 5); !covered[hash] {
+				t.Errorf("the cell %s of (%v, %v) isn't covered by %v", hash, lat, lon, cells)
+			}
+		}
+	}
+}
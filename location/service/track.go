@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// TrackPoint is a recorded location of the driver
+type TrackPoint struct {
+	Key    string
+	Lat    float64
+	Lon    float64
+	RideID int // 0 when the driver had no ride
+	At     time.Time
+}
+
+// TrackStore keeps the breadcrumbs of the drivers for the retention,
+// a point is recorded at most once per interval unless the ride changes
+type TrackStore interface {
+	Append(ctx context.Context, points ...TrackPoint) error
+	// Range returns the points of the key recorded in [from, to] by time ASC
+	Range(ctx context.Context, key string, from, to time.Time) ([]TrackPoint, error)
+}
+
+type redisTrack struct {
+	rdb       redis.UniversalClient
+	key       string
+	interval  time.Duration
+	retention time.Duration
+}
+
+// NewRedisTrack keeps the points of every driver in the <key>.{<driver>} stream,
+// the stream ids are the record times so the ranges are XRANGE by time
+func NewRedisTrack(rdb redis.UniversalClient, key string, interval, retention time.Duration) TrackStore {
+	return &redisTrack{rdb, key, interval, retention}
+}
+
+func (t redisTrack) streamKey(key string) string {
+	return t.key + ".{" + key + "}"
+}
+
+// appendScript adds the point ARGV[4..6] taken at ARGV[1] ms to the stream KEYS[1]
+// when the last one is older than ARGV[2] ms or has another ride, trims the points
+// before ARGV[3] ms and expires the stream of the drivers who stopped sending after ARGV[7] ms
+var appendScript = redis.NewScript(`
+local last = redis.call('XREVRANGE', KEYS[1], '+', '-', 'COUNT', 1)
+if #last > 0 then
+	local ms = tonumber(string.match(last[1][1], '^(%d+)'))
+	local fields = last[1][2]
+	local at = tonumber(ARGV[1])
+	if at <= ms or (at - ms < tonumber(ARGV[2]) and fields[6] == ARGV[6]) then
+		return 0
+	end
+end
+redis.call('XADD', KEYS[1], 'MINID', '~', ARGV[3], ARGV[1] .. '-0', 'lat', ARGV[4], 'lon', ARGV[5], 'ride', ARGV[6])
+redis.call('PEXPIRE', KEYS[1], ARGV[7])
+return 1
+`)
+
+func (t redisTrack) Append(ctx context.Context, points ...TrackPoint) error {
+	pipe := t.rdb.Pipeline()
+	for _, p := range points {
+		at := p.At.UnixNano() / int64(time.Millisecond)
+
+		appendScript.Eval(ctx, pipe, []string{t.streamKey(p.Key)},
+			at,
+			t.interval.Milliseconds(),
+			at-t.retention.Milliseconds(),
+			strconv.FormatFloat(p.Lat, 'f', -1, 64),
+			strconv.FormatFloat(p.Lon, 'f', -1, 64),
+			strconv.Itoa(p.RideID),
+			t.retention.Milliseconds(),
+		)
+	}
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (t redisTrack) Range(ctx context.Context, key string, from, to time.Time) ([]TrackPoint, error) {
+	start := strconv.FormatInt(from.UnixNano()/int64(time.Millisecond), 10)
+	end := strconv.FormatInt(to.UnixNano()/int64(time.Millisecond), 10)
+
+	msgs, err := t.rdb.XRange(ctx, t.streamKey(key), start, end).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]TrackPoint, 0, len(msgs))
+	for _, msg := range msgs {
+		ms, err := strconv.ParseInt(strings.SplitN(msg.ID, "-", 2)[0], 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		p := TrackPoint{Key: key, At: time.Unix(0, ms*int64(time.Millisecond))}
+		p.Lat, _ = strconv.ParseFloat(field(msg.Values, "lat"), 64)
+		p.Lon, _ = strconv.ParseFloat(field(msg.Values, "lon"), 64)
+		p.RideID, _ = strconv.Atoi(field(msg.Values, "ride"))
+
+		points = append(points, p)
+	}
+
+	return points, nil
+}
+
+func field(values map[string]interface{}, name string) string {
+	v, _ := values[name].(string)
+	return v
+}
+
+// memoryTrack keeps the points in the process, for local runs and tests
+type memoryTrack struct {
+	mutex     sync.Mutex
+	points    map[string][]TrackPoint
+	interval  time.Duration
+	retention time.Duration
+}
+
+func NewMemoryTrack(interval, retention time.Duration) TrackStore {
+	return &memoryTrack{points: map[string][]TrackPoint{}, interval: interval, retention: retention}
+}
+
+func (t *memoryTrack) Append(ctx context.Context, points ...TrackPoint) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, p := range points {
+		track := t.points[p.Key]
+
+		if n := len(track); n > 0 && p.At.Sub(track[n-1].At) < t.interval && track[n-1].RideID == p.RideID {
+			continue
+		}
+
+		// drop the points past the retention
+		min := p.At.Add(-t.retention)
+		i := 0
+		for i < len(track) && track[i].At.Before(min) {
+			i++
+		}
+
+		t.points[p.Key] = append(track[i:], p)
+	}
+
+	return nil
+}
+
+func (t *memoryTrack) Range(ctx context.Context, key string, from, to time.Time) ([]TrackPoint, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	points := []TrackPoint{}
+	for _, p := range t.points[key] {
+		if !p.At.Before(from) && !p.At.After(to) {
+			points = append(points, p)
+		}
+	}
+
+	return points, nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryTrack(t *testing.T) {
+	start := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	tests := []struct {
+		name   string
+		points []TrackPoint
+		from   time.Time
+		to     time.Time
+		want   []time.Time
+	}{
+		{"every interval", []TrackPoint{
+			{At: at(0)}, {At: at(10 * time.Second)}, {At: at(20 * time.Second)},
+		}, at(0), at(time.Hour), []time.Time{at(0), at(10 * time.Second), at(20 * time.Second)}},
+		{"within the interval", []TrackPoint{
+			{At: at(0)}, {At: at(5 * time.Second)}, {At: at(10 * time.Second)},
+		}, at(0), at(time.Hour), []time.Time{at(0), at(10 * time.Second)}},
+		{"ride changes within the interval", []TrackPoint{
+			{At: at(0)}, {At: at(time.Second), RideID: 7}, {At: at(2 * time.Second), RideID: 7},
+		}, at(0), at(time.Hour), []time.Time{at(0), at(time.Second)}},
+		{"past the retention", []TrackPoint{
+			{At: at(0)}, {At: at(30 * time.Minute)}, {At: at(90 * time.Minute)},
+		}, at(0), at(2 * time.Hour), []time.Time{at(30 * time.Minute), at(90 * time.Minute)}},
+		{"range", []TrackPoint{
+			{At: at(0)}, {At: at(10 * time.Second)}, {At: at(20 * time.Second)}, {At: at(30 * time.Second)},
+		}, at(10 * time.Second), at(20 * time.Second), []time.Time{at(10 * time.Second), at(20 * time.Second)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := NewMemoryTrack(10*time.Second, time.Hour)
+			ctx := context.Background()
+
+			for i := range tt.points {
+				tt.points[i].Key = "1"
+			}
+
+			// one by one, every point is appended after the previous one
+			for _, p := range tt.points {
+				if err := track.Append(ctx, p); err != nil {
+					t.Fatalf("Append: %v", err)
+				}
+			}
+
+			points, err := track.Range(ctx, "1", tt.from, tt.to)
+
+			if err != nil {
+				t.Fatalf("Range: %v", err)
+			}
+
+			got := []time.Time{}
+			for _, p := range points {
+				got = append(got, p.At)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Range = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackDistance(t *testing.T) {
+	now := time.Now()
+	track := NewMemoryTrack(time.Second, time.Hour)
+	s := NewService(nil, NewMemoryIndex(), track, nil, NewMemoryRemovals(), time.Minute, false)
+	ctx := context.Background()
+
+	track.Append(ctx,
+		TrackPoint{Key: "1", Lat: almatyLat, Lon: almatyLon, RideID: 7, At: now.Add(-3 * time.Minute)},
+		TrackPoint{Key: "1", Lat: almatyLat + 0.009, Lon: almatyLon, RideID: 7, At: now.Add(-2 * time.Minute)},
+		TrackPoint{Key: "1", Lat: almatyLat + 0.018, Lon: almatyLon, RideID: 8, At: now.Add(-time.Minute)},
+	)
+
+	tests := []struct {
+		name   string
+		rideID int
+		points int
+		km     float64
+	}{
+		{"every point", 0, 3, 2},
+		{"ride", 7, 2, 1},
+		{"unknown ride", 9, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.Track(ctx, "1", tt.rideID, time.Time{}, time.Time{})
+
+			if err != nil {
+				t.Fatalf("Track: %v", err)
+			}
+
+			if len(res.Points) != tt.points || res.Distance < tt.km*0.99 || res.Distance > tt.km*1.01 {
+				t.Errorf("Track(%d) = %d points %.3f km, want %d points %.0f km",
+					tt.rideID, len(res.Points), res.Distance, tt.points, tt.km)
+			}
+		})
+	}
+}
@@ -4,22 +4,41 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
+	"time"
 
+	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
 	gt "github.com/go-kit/kit/transport/grpc"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/jadilet/taximicroservice/location/endpoints"
 	"github.com/jadilet/taximicroservice/location/pb"
+	"github.com/jadilet/taximicroservice/location/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type gRPCServer struct {
-	set     gt.Handler
-	nearest gt.Handler
+	set      gt.Handler
+	nearest  gt.Handler
+	remove   gt.Handler
+	get      gt.Handler
+	batchSet gt.Handler
+	inBox    gt.Handler
+	track    gt.Handler
+	batch    endpoint.Endpoint // StreamLocations writes
 	pb.UnimplementedLocationServer
 }
 
+const (
+	// StreamLocations writes the locations to redis
+	// every streamBatchSize locations or streamFlushInterval
+	streamBatchSize     = 100
+	streamFlushInterval = 500 * time.Millisecond
+)
+
 func NewGRPCServer(endpoint endpoints.Endpoint, logger log.Logger) pb.LocationServer {
 	return &gRPCServer{
 		set: gt.NewServer(
@@ -32,6 +51,32 @@ func NewGRPCServer(endpoint endpoints.Endpoint, logger log.Logger) pb.LocationSe
 			decodeNearestRequest,
 			encodeNearestResponse,
 		),
+		remove: gt.NewServer(
+			endpoint.Remove,
+			decodeRemoveRequest,
+			encodeSetResponse,
+		),
+		get: gt.NewServer(
+			endpoint.Get,
+			decodeGetRequest,
+			encodeGetResponse,
+		),
+		batchSet: gt.NewServer(
+			endpoint.BatchSet,
+			decodeBatchSetRequest,
+			encodeSetResponse,
+		),
+		inBox: gt.NewServer(
+			endpoint.InBox,
+			decodeInBoxRequest,
+			encodeNearestResponse,
+		),
+		track: gt.NewServer(
+			endpoint.Track,
+			decodeTrackRequest,
+			encodeTrackResponse,
+		),
+		batch: endpoint.BatchSet,
 	}
 }
 
@@ -39,61 +84,326 @@ func (s *gRPCServer) Nearest(ctx context.Context, req *pb.GeoRequest) (*pb.GeoRe
 	_, resp, err := s.nearest.ServeGRPC(ctx, req)
 
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
 	}
 
 	return resp.(*pb.GeoResponse), nil
 }
 
+func (s *gRPCServer) InBox(ctx context.Context, req *pb.BoxRequest) (*pb.GeoResponse, error) {
+	_, resp, err := s.inBox.ServeGRPC(ctx, req)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return resp.(*pb.GeoResponse), nil
+}
+
+func (s *gRPCServer) Track(ctx context.Context, req *pb.TrackRequest) (*pb.TrackResponse, error) {
+	_, resp, err := s.track.ServeGRPC(ctx, req)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return resp.(*pb.TrackResponse), nil
+}
+
 func (s *gRPCServer) Set(ctx context.Context, req *pb.RequestLocation) (*empty.Empty, error) {
 	_, resp, err := s.set.ServeGRPC(ctx, req)
 
 	if err != nil {
-		return nil, err
+		return nil, grpcError(err)
+	}
+
+	return resp.(*empty.Empty), nil
+}
+
+func (s *gRPCServer) Remove(ctx context.Context, req *pb.RequestRemove) (*empty.Empty, error) {
+	_, resp, err := s.remove.ServeGRPC(ctx, req)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return resp.(*empty.Empty), nil
+}
+
+func (s *gRPCServer) Get(ctx context.Context, req *pb.RequestGet) (*pb.GeoLocation, error) {
+	_, resp, err := s.get.ServeGRPC(ctx, req)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return resp.(*pb.GeoLocation), nil
+}
+
+func (s *gRPCServer) BatchSet(ctx context.Context, req *pb.RequestBatchLocation) (*empty.Empty, error) {
+	_, resp, err := s.batchSet.ServeGRPC(ctx, req)
+
+	if err != nil {
+		return nil, grpcError(err)
 	}
 
 	return resp.(*empty.Empty), nil
 }
 
+func (s *gRPCServer) StreamLocations(stream pb.Location_StreamLocationsServer) error {
+	ctx := stream.Context()
+	reqs := make(chan *pb.RequestLocation)
+	errs := make(chan error, 1)
+
+	go func() {
+		for {
+			req, err := stream.Recv()
+
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+
+	var received, rejected int32
+	batch := make([]endpoints.RequestLocation, 0, streamBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		_, err := s.batch(ctx, endpoints.RequestBatchLocation{Locations: batch})
+		batch = batch[:0]
+
+		var invalid *service.RejectedLocationsError
+		if errors.As(err, &invalid) {
+			rejected += int32(invalid.Rejected)
+			return nil
+		}
+
+		return err
+	}
+
+	for {
+		select {
+		case req := <-reqs:
+			received++
+			loc, err := decodeSetRequest(ctx, req)
+
+			if err != nil {
+				rejected++
+				continue
+			}
+
+			batch = append(batch, loc.(endpoints.RequestLocation))
+
+			if len(batch) >= streamBatchSize {
+				if err := flush(); err != nil {
+					return grpcError(err)
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return grpcError(err)
+			}
+		case err := <-errs:
+			if err != io.EOF {
+				return err
+			}
+
+			if err := flush(); err != nil {
+				return grpcError(err)
+			}
+
+			return stream.SendAndClose(&pb.StreamSummary{Received: received, Rejected: rejected})
+		case <-ctx.Done():
+			return grpcError(ctx.Err())
+		}
+	}
+}
+
+// grpcError returns the service errors with their gRPC status codes,
+// the errors of redis are Unavailable so the callers retry later
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var invalid *service.InvalidLocationError
+	var rejected *service.RejectedLocationsError
+
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &invalid), errors.As(err, &rejected), errors.Is(err, service.ErrTooManyCells):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
+
 func decodeSetRequest(_ context.Context, request interface{}) (interface{}, error) {
 	req := request.(*pb.RequestLocation)
 
 	if req.P == nil {
-		return nil, errors.New("pb.Locaion.Set request location can't be blank")
+		return nil, status.Error(codes.InvalidArgument, "pb.Location.Set request location can't be blank")
 	}
 
 	p := endpoints.Point{Lat: req.P.Latitude, Lon: req.P.Longitude}
-	return endpoints.RequestLocation{Key: fmt.Sprintf("driver_%d", req.Key), P: p}, nil
+	return endpoints.RequestLocation{Key: fmt.Sprintf("driver_%d", req.Key), P: p, Attrs: req.Attrs,
+		RideID: int(req.RideId), Epoch: req.Epoch}, nil
+}
+
+func decodeRemoveRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.RequestRemove)
+
+	return endpoints.RequestRemove{Key: fmt.Sprintf("driver_%d", req.Key), Epoch: req.Epoch}, nil
+}
+
+func decodeGetRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.RequestGet)
+
+	return endpoints.RequestGet{Key: fmt.Sprintf("driver_%d", req.Key)}, nil
+}
+
+func decodeBatchSetRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.RequestBatchLocation)
+
+	locations := make([]endpoints.RequestLocation, 0, len(req.Locations))
+	for _, l := range req.Locations {
+		loc, err := decodeSetRequest(ctx, l)
+
+		if err != nil {
+			return nil, err
+		}
+
+		locations = append(locations, loc.(endpoints.RequestLocation))
+	}
+
+	return endpoints.RequestBatchLocation{Locations: locations}, nil
 }
 
 func decodeNearestRequest(_ context.Context, request interface{}) (interface{}, error) {
 	req := request.(*pb.GeoRequest)
 
-	return endpoints.GeoRequest{Lat: req.Lat, Lon: req.Lon, Radius: req.Radius}, nil
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "pb.Location.Nearest limit can't be negative")
+	}
+
+	exclude := make([]string, len(req.ExcludeIds))
+	for i, id := range req.ExcludeIds {
+		exclude[i] = fmt.Sprintf("driver_%d", id)
+	}
+
+	return endpoints.GeoRequest{Lat: req.Lat, Lon: req.Lon, Radius: req.Radius,
+		Limit: int(req.Limit), Exclude: exclude, Filters: req.Filters}, nil
+}
+
+func decodeInBoxRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.BoxRequest)
+
+	switch {
+	case req.MinLat < -90 || req.MaxLat > 90 || req.MinLon < -180 || req.MaxLon > 180:
+		return nil, status.Error(codes.InvalidArgument, "pb.Location.InBox box is out of the coordinates range")
+	case req.MinLat >= req.MaxLat || req.MinLon >= req.MaxLon:
+		return nil, status.Error(codes.InvalidArgument, "pb.Location.InBox box min must be less than max")
+	case req.Limit < 0:
+		return nil, status.Error(codes.InvalidArgument, "pb.Location.InBox limit can't be negative")
+	}
+
+	box := service.Box{MinLat: req.MinLat, MinLon: req.MinLon, MaxLat: req.MaxLat, MaxLon: req.MaxLon}
+	return endpoints.BoxRequest{Box: box, Limit: int(req.Limit)}, nil
+}
+
+func decodeTrackRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.TrackRequest)
+
+	if req.From < 0 || req.To < 0 || (req.To != 0 && req.To < req.From) {
+		return nil, status.Error(codes.InvalidArgument, "pb.Location.Track invalid time window")
+	}
+
+	track := endpoints.TrackRequest{Key: fmt.Sprintf("driver_%d", req.Key), RideID: int(req.RideId)}
+
+	if req.From != 0 {
+		track.From = time.Unix(req.From, 0)
+	}
+
+	if req.To != 0 {
+		track.To = time.Unix(req.To, 0)
+	}
+
+	return track, nil
+}
+
+func encodeTrackResponse(_ context.Context, response interface{}) (interface{}, error) {
+	track := response.(service.Track)
+
+	points := make([]*pb.TrackPoint, len(track.Points))
+	for i, p := range track.Points {
+		points[i] = &pb.TrackPoint{
+			Latitude:  p.Lat,
+			Longitude: p.Lon,
+			RideId:    int32(p.RideID),
+			At:        p.At.UnixNano() / int64(time.Millisecond),
+		}
+	}
+
+	return &pb.TrackResponse{Points: points, Distance: track.Distance}, nil
 }
 
 func encodeNearestResponse(_ context.Context, response interface{}) (interface{}, error) {
 	resp := response.(endpoints.GeoResponse)
-	reg := regexp.MustCompile("[0-9]+")
 
 	res := []*pb.GeoLocation{}
 	for _, v := range resp.Locations {
-		id, err := strconv.Atoi(reg.FindString(v.Name))
+		loc, err := toGeoLocation(v)
 
 		if err != nil {
 			continue
 		}
 
-		res = append(res, &pb.GeoLocation{
-			Id:        int32(id),
-			Name:      v.Name,
-			Longitude: v.Longitude,
-			Latitude:  v.Latitude,
-			Dist:      v.Dist,
-			Geohash:   v.GeoHash})
+		res = append(res, loc)
+	}
+
+	return &pb.GeoResponse{Locations: res}, nil
+}
+
+func encodeGetResponse(_ context.Context, response interface{}) (interface{}, error) {
+	return toGeoLocation(response.(service.Location))
+}
+
+var driverIDReg = regexp.MustCompile("[0-9]+")
+
+// toGeoLocation reads the driver id from the driver_<id> key
+func toGeoLocation(v service.Location) (*pb.GeoLocation, error) {
+	id, err := strconv.Atoi(driverIDReg.FindString(v.Name))
+
+	if err != nil {
+		return nil, err
 	}
 
-	return &pb.GeoResponse{Locations: res, Err: resp.Err}, nil
+	return &pb.GeoLocation{
+		Id:        int32(id),
+		Name:      v.Name,
+		Longitude: v.Longitude,
+		Latitude:  v.Latitude,
+		Dist:      v.Dist,
+		Geohash:   v.GeoHash,
+		LastSeen:  v.LastSeen.Unix(),
+		Attrs:     v.Attrs}, nil
 }
 
 func encodeSetResponse(_ context.Context, response interface{}) (interface{}, error) {
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jadilet/taximicroservice/passengermanagement/endpoints"
+	"github.com/jadilet/taximicroservice/passengermanagement/pb"
+	"github.com/jadilet/taximicroservice/passengermanagement/service"
+	"github.com/jadilet/taximicroservice/passengermanagement/transports"
+	"github.com/jadilet/taximicroservice/pkg/auth"
+	"github.com/jadilet/taximicroservice/pkg/mtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/joho/godotenv"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func main() {
+	var (
+		httpAddr = flag.String("http.addr", ":8082", "HTTP listen address")
+	)
+	flag.Parse()
+
+	err := godotenv.Load()
+
+	var logger log.Logger
+	{
+		logger = log.NewLogfmtLogger(os.Stderr)
+		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+		logger = log.With(logger, "caller", log.DefaultCaller)
+	}
+
+	if err != nil {
+		logger.Log("Error while reading the .env file")
+	}
+
+	dnsMaster := fmt.Sprintf(
+		"%s:%s@%s(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		os.Getenv("MYSQL_USER"),
+		os.Getenv("MYSQL_PASSWORD"),
+		os.Getenv("MYSQL_PROTOCOL"),
+		os.Getenv("MYSQL_MASTER_HOST"),
+		os.Getenv("MYSQL_MASTER_PORT"),
+		os.Getenv("MYSQL_DBNAME"),
+	)
+
+	masterDb, err := dbConnection(logger, dnsMaster, 15, 100, true)
+
+	if err != nil {
+		logger.Log("Master database ", err)
+		return
+	}
+
+	dnsSlave := fmt.Sprintf(
+		"%s:%s@%s(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		os.Getenv("MYSQL_USER"),
+		os.Getenv("MYSQL_PASSWORD"),
+		os.Getenv("MYSQL_PROTOCOL"),
+		os.Getenv("MYSQL_SLAVE_HOST"),
+		os.Getenv("MYSQL_SLAVE_PORT"),
+		os.Getenv("MYSQL_DBNAME"),
+	)
+
+	slaveDb, err := dbConnection(logger, dnsSlave, 15, 100, false)
+
+	if err != nil {
+		logger.Log("Slave database ", err)
+		return
+	}
+
+	// AUTH_PUBLIC_KEY_FILE, AUTH_PRIVATE_KEY_FILE: PEM RSA keys of the RS256 tokens,
+	// the passenger management service issues the passenger tokens so it needs both
+	// AUTH_KEY_FILE: shared HS256 secret instead of the RSA keys for local runs and tests
+	keys, err := auth.LoadKeys()
+
+	if err != nil {
+		logger.Log("Failed to load the auth keys", err)
+		return
+	}
+
+	// GRPC_TLS_CERT_FILE, GRPC_TLS_KEY_FILE, GRPC_TLS_CA_FILE: see mtls.FromEnv,
+	// with mTLS only tripmanagement checks the passengers
+	tlsConfig, err := mtls.FromEnv()
+
+	if err != nil {
+		logger.Log("Failed to load the gRPC TLS configuration", err)
+		return
+	}
+
+	if !tlsConfig.Mutual() {
+		level.Warn(logger).Log("msg", "gRPC callers aren't authenticated, mTLS isn't configured")
+	}
+
+	s := service.NewPassengerService(logger, masterDb, slaveDb)
+	h := transports.MakeHTTPHandler(s, keys, log.With(logger, "component", "HTTP"))
+
+	checkendpoints := endpoints.MakeGrpcEndpoint(s)
+	grpcServer := transports.NewGRPCServer(checkendpoints, logger)
+
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%s", os.Getenv("GRPC_PASSENGERMANAGEMENT_SRV_PORT")))
+
+	if err != nil {
+		logger.Log("during", "Listen Passenger Management GRPC Server", "err", err)
+		os.Exit(1)
+	}
+
+	go func() {
+		baseServer := grpc.NewServer(tlsConfig.ServerOptions(mtls.Rules{
+			"/pb.Passenger/Check": {"tripmanagement"},
+		})...)
+		reflection.Register(baseServer)
+		pb.RegisterPassengerServer(baseServer, grpcServer)
+		level.Info(logger).Log("msg", "Passenger Management GRPC Server started successfully", "port",
+			os.Getenv("GRPC_PASSENGERMANAGEMENT_SRV_PORT"))
+
+		err = baseServer.Serve(grpcListener)
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to serve Passenger Management GRPC Server")
+			os.Exit(1)
+		}
+	}()
+
+	errs := make(chan error)
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, os.Interrupt)
+		signal.Notify(sigChan, syscall.SIGTERM)
+		errs <- fmt.Errorf("%s", <-sigChan)
+
+	}()
+
+	go func() {
+
+		logger.Log("transport", "HTTP", "addr", *httpAddr)
+		errs <- http.ListenAndServe(*httpAddr, h)
+	}()
+
+	logger.Log("exit", <-errs)
+}
+
+func dbConnection(logger log.Logger, dns string, maxIdleConns, maxOpenConns int,
+	isMaster bool) (*gorm.DB, error) {
+	db, err := gorm.Open(mysql.Open(dns), &gorm.Config{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if isMaster {
+		err = service.Migrate(db, logger)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sqlDB, err := db.DB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
+	sqlDB.SetMaxIdleConns(maxIdleConns)
+
+	// SetMaxOpenConns sets the maximum number of open connections to the database.
+	sqlDB.SetMaxOpenConns(maxOpenConns)
+
+	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
+	sqlDB.SetConnMaxLifetime(time.Hour)
+
+	return db, nil
+}
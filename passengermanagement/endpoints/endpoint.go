@@ -0,0 +1,299 @@
+package endpoints
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jadilet/taximicroservice/passengermanagement/service"
+	"github.com/jadilet/taximicroservice/pkg/auth"
+)
+
+type EndpointHttp struct {
+	Register            endpoint.Endpoint
+	Login               endpoint.Endpoint
+	Refresh             endpoint.Endpoint
+	Profile             endpoint.Endpoint
+	UpdateProfile       endpoint.Endpoint
+	AddPaymentMethod    endpoint.Endpoint
+	PaymentMethods      endpoint.Endpoint
+	RemovePaymentMethod endpoint.Endpoint
+	Get                 endpoint.Endpoint
+	Block               endpoint.Endpoint
+	Unblock             endpoint.Endpoint
+}
+
+type EndpointGrpc struct {
+	Check endpoint.Endpoint
+}
+
+// RegisterReq has the fields a passenger sets on registration,
+// the others e.g. the ID and Blocked are set by the service
+type RegisterReq struct {
+	Name      string `validate:"required,max=100"`
+	Email     string `validate:"required,email,max=254"`
+	Telephone string `validate:"required,e164"`
+	Password  string `validate:"required,min=8,max=72"` // bcrypt reads 72 bytes at most
+}
+
+type LoginReq struct {
+	Email    string `validate:"required,email"`
+	Password string `validate:"required"`
+}
+
+type RefreshReq struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResp struct {
+	auth.Tokens
+	Err error `json:"error,omitempty"`
+}
+
+// MeReq is a request of the passenger of the token
+type MeReq struct{}
+
+type ProfileReq struct {
+	Name      string `validate:"required,max=100"`
+	Email     string `validate:"required,email,max=254"`
+	Telephone string `validate:"required,e164"`
+}
+
+type PassengerIDReq struct {
+	PassengerID uint
+}
+
+type BlockReq struct {
+	PassengerID uint   `json:"-"`
+	Reason      string `validate:"required,max=255"`
+}
+
+// PaymentMethodReq is the reference of a payment method kept by the provider
+type PaymentMethodReq struct {
+	Provider  string `validate:"required,alphanum,max=32"`
+	Reference string `validate:"required,max=255"`
+	Brand     string `validate:"omitempty,max=32"`
+	Last4     string `validate:"omitempty,numeric,len=4"`
+	IsDefault bool
+}
+
+type PaymentMethodIDReq struct {
+	MethodID uint
+}
+
+type PassengerResp struct {
+	Passenger service.Passenger `json:"passenger"`
+	Err       error             `json:"error,omitempty"`
+}
+
+type PaymentMethodResp struct {
+	Method service.PaymentMethod `json:"payment_method"`
+	Err    error                 `json:"error,omitempty"`
+}
+
+type PaymentMethodsResp struct {
+	Methods []service.PaymentMethod `json:"payment_methods"`
+	Err     error                   `json:"error,omitempty"`
+}
+
+type PassengerMsgResp struct {
+	Msg string `json:"msg"`
+	Err error  `json:"error,omitempty"`
+}
+
+func makeRegisterEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RegisterReq)
+		msg, err := s.Register(ctx, service.Passenger{
+			Name:      req.Name,
+			Email:     req.Email,
+			Telephone: req.Telephone,
+		}, req.Password)
+
+		return PassengerMsgResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeLoginEndpoint(s service.PassengerService, keys *auth.Keys) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(LoginReq)
+		passengerID, err := s.Login(ctx, req.Email, req.Password)
+
+		if err != nil {
+			return TokenResp{Err: err}, err
+		}
+
+		tokens, err := keys.Issue(passengerID, auth.RolePassenger)
+
+		return TokenResp{Tokens: tokens, Err: err}, err
+	}
+}
+
+// makeRefreshEndpoint issues new tokens while the passenger isn't blocked
+func makeRefreshEndpoint(s service.PassengerService, keys *auth.Keys) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RefreshReq)
+		passengerID, role, err := keys.Refresh(req.RefreshToken)
+
+		if err == nil && role != auth.RolePassenger {
+			err = auth.ErrForbidden
+		}
+
+		if err == nil {
+			err = s.CanLogin(ctx, passengerID)
+		}
+
+		if err != nil {
+			return TokenResp{Err: err}, err
+		}
+
+		tokens, err := keys.Issue(passengerID, auth.RolePassenger)
+
+		return TokenResp{Tokens: tokens, Err: err}, err
+	}
+}
+
+func makeProfileEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		passengerID, err := auth.Subject(ctx)
+
+		if err != nil {
+			return PassengerResp{Err: err}, err
+		}
+
+		passenger, err := s.Get(ctx, passengerID)
+
+		return PassengerResp{Passenger: passenger, Err: err}, err
+	}
+}
+
+func makeUpdateProfileEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(ProfileReq)
+		passengerID, err := auth.Subject(ctx)
+
+		if err != nil {
+			return PassengerResp{Err: err}, err
+		}
+
+		passenger, err := s.UpdateProfile(ctx, passengerID, service.Profile{
+			Name:      req.Name,
+			Email:     req.Email,
+			Telephone: req.Telephone,
+		})
+
+		return PassengerResp{Passenger: passenger, Err: err}, err
+	}
+}
+
+func makeAddPaymentMethodEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(PaymentMethodReq)
+		passengerID, err := auth.Subject(ctx)
+
+		if err != nil {
+			return PaymentMethodResp{Err: err}, err
+		}
+
+		method, err := s.AddPaymentMethod(ctx, passengerID, service.PaymentMethod{
+			Provider:  req.Provider,
+			Reference: req.Reference,
+			Brand:     req.Brand,
+			Last4:     req.Last4,
+			IsDefault: req.IsDefault,
+		})
+
+		return PaymentMethodResp{Method: method, Err: err}, err
+	}
+}
+
+func makePaymentMethodsEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		passengerID, err := auth.Subject(ctx)
+
+		if err != nil {
+			return PaymentMethodsResp{Err: err}, err
+		}
+
+		methods, err := s.PaymentMethods(ctx, passengerID)
+
+		return PaymentMethodsResp{Methods: methods, Err: err}, err
+	}
+}
+
+func makeRemovePaymentMethodEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(PaymentMethodIDReq)
+		passengerID, err := auth.Subject(ctx)
+
+		if err != nil {
+			return PassengerMsgResp{Err: err}, err
+		}
+
+		msg, err := s.RemovePaymentMethod(ctx, passengerID, req.MethodID)
+
+		return PassengerMsgResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeGetEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(PassengerIDReq)
+		passenger, err := s.Get(ctx, req.PassengerID)
+
+		return PassengerResp{Passenger: passenger, Err: err}, err
+	}
+}
+
+func makeBlockEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(BlockReq)
+		msg, err := s.Block(ctx, req.PassengerID, req.Reason)
+
+		return PassengerMsgResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeUnblockEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(PassengerIDReq)
+		msg, err := s.Unblock(ctx, req.PassengerID)
+
+		return PassengerMsgResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeCheckEndpoint(s service.PassengerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(PassengerIDReq)
+		passenger, err := s.Check(ctx, req.PassengerID)
+
+		return PassengerResp{Passenger: passenger, Err: err}, err
+	}
+}
+
+func MakeGrpcEndpoint(s service.PassengerService) EndpointGrpc {
+	return EndpointGrpc{
+		Check: makeCheckEndpoint(s),
+	}
+}
+
+// MakeHttpEndpoint returns the passenger app endpoints, the passengers are identified
+// by their access token except for register, login and refresh, the admins block them
+func MakeHttpEndpoint(s service.PassengerService, keys *auth.Keys) EndpointHttp {
+	passenger := keys.Middleware(auth.RolePassenger)
+	admin := keys.Middleware(auth.RoleAdmin)
+
+	return EndpointHttp{
+		Register:            makeRegisterEndpoint(s),
+		Login:               makeLoginEndpoint(s, keys),
+		Refresh:             makeRefreshEndpoint(s, keys),
+		Profile:             passenger(makeProfileEndpoint(s)),
+		UpdateProfile:       passenger(makeUpdateProfileEndpoint(s)),
+		AddPaymentMethod:    passenger(makeAddPaymentMethodEndpoint(s)),
+		PaymentMethods:      passenger(makePaymentMethodsEndpoint(s)),
+		RemovePaymentMethod: passenger(makeRemovePaymentMethodEndpoint(s)),
+		Get:                 admin(makeGetEndpoint(s)),
+		Block:               admin(makeBlockEndpoint(s)),
+		Unblock:             admin(makeUnblockEndpoint(s)),
+	}
+}
@@ -0,0 +1,231 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.26.0
+// 	protoc        v3.7.1
+// source: pb/passenger.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PassengerRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Passengerid uint64 `protobuf:"varint,1,opt,name=passengerid,proto3" json:"passengerid,omitempty"`
+}
+
+func (x *PassengerRequest) Reset() {
+	*x = PassengerRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_passenger_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PassengerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PassengerRequest) ProtoMessage() {}
+
+func (x *PassengerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_passenger_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PassengerRequest.ProtoReflect.Descriptor instead.
+func (*PassengerRequest) Descriptor() ([]byte, []int) {
+	return file_pb_passenger_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PassengerRequest) GetPassengerid() uint64 {
+	if x != nil {
+		return x.Passengerid
+	}
+	return 0
+}
+
+type PassengerResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Passengerid uint64 `protobuf:"varint,1,opt,name=passengerid,proto3" json:"passengerid,omitempty"`
+	Name        string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Telephone   string `protobuf:"bytes,3,opt,name=telephone,proto3" json:"telephone,omitempty"`
+}
+
+func (x *PassengerResponse) Reset() {
+	*x = PassengerResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pb_passenger_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PassengerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PassengerResponse) ProtoMessage() {}
+
+func (x *PassengerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_passenger_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PassengerResponse.ProtoReflect.Descriptor instead.
+func (*PassengerResponse) Descriptor() ([]byte, []int) {
+	return file_pb_passenger_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PassengerResponse) GetPassengerid() uint64 {
+	if x != nil {
+		return x.Passengerid
+	}
+	return 0
+}
+
+func (x *PassengerResponse) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PassengerResponse) GetTelephone() string {
+	if x != nil {
+		return x.Telephone
+	}
+	return ""
+}
+
+var File_pb_passenger_proto protoreflect.FileDescriptor
+
+var file_pb_passenger_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x70, 0x62, 0x2f, 0x70, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67, 0x65, 0x72, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x02, 0x70, 0x62, 0x22, 0x34, 0x0a, 0x10, 0x50, 0x61, 0x73, 0x73,
+	0x65, 0x6e, 0x67, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x20, 0x0a, 0x0b,
+	0x70, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67, 0x65, 0x72, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x0b, 0x70, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67, 0x65, 0x72, 0x69, 0x64, 0x22, 0x67,
+	0x0a, 0x11, 0x50, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x70, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67, 0x65, 0x72,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x70, 0x61, 0x73, 0x73, 0x65, 0x6e,
+	0x67, 0x65, 0x72, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x65, 0x6c,
+	0x65, 0x70, 0x68, 0x6f, 0x6e, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x74, 0x65,
+	0x6c, 0x65, 0x70, 0x68, 0x6f, 0x6e, 0x65, 0x32, 0x43, 0x0a, 0x09, 0x50, 0x61, 0x73, 0x73, 0x65,
+	0x6e, 0x67, 0x65, 0x72, 0x12, 0x36, 0x0a, 0x05, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x12, 0x14, 0x2e,
+	0x70, 0x62, 0x2e, 0x50, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67,
+	0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x06, 0x5a, 0x04,
+	0x2e, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_pb_passenger_proto_rawDescOnce sync.Once
+	file_pb_passenger_proto_rawDescData = file_pb_passenger_proto_rawDesc
+)
+
+func file_pb_passenger_proto_rawDescGZIP() []byte {
+	file_pb_passenger_proto_rawDescOnce.Do(func() {
+		file_pb_passenger_proto_rawDescData = protoimpl.X.CompressGZIP(file_pb_passenger_proto_rawDescData)
+	})
+	return file_pb_passenger_proto_rawDescData
+}
+
+var file_pb_passenger_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_pb_passenger_proto_goTypes = []interface{}{
+	(*PassengerRequest)(nil),  // 0: pb.PassengerRequest
+	(*PassengerResponse)(nil), // 1: pb.PassengerResponse
+}
+var file_pb_passenger_proto_depIdxs = []int32{
+	0, // 0: pb.Passenger.Check:input_type -> pb.PassengerRequest
+	1, // 1: pb.Passenger.Check:output_type -> pb.PassengerResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_pb_passenger_proto_init() }
+func file_pb_passenger_proto_init() {
+	if File_pb_passenger_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_pb_passenger_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PassengerRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pb_passenger_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PassengerResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_pb_passenger_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pb_passenger_proto_goTypes,
+		DependencyIndexes: file_pb_passenger_proto_depIdxs,
+		MessageInfos:      file_pb_passenger_proto_msgTypes,
+	}.Build()
+	File_pb_passenger_proto = out.File
+	file_pb_passenger_proto_rawDesc = nil
+	file_pb_passenger_proto_goTypes = nil
+	file_pb_passenger_proto_depIdxs = nil
+}
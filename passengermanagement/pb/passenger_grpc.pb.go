@@ -0,0 +1,105 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// PassengerClient is the client API for Passenger service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PassengerClient interface {
+	// Check returns the passenger who may request a ride,
+	// NotFound for an unknown passenger, FailedPrecondition for a blocked one
+	Check(ctx context.Context, in *PassengerRequest, opts ...grpc.CallOption) (*PassengerResponse, error)
+}
+
+type passengerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPassengerClient(cc grpc.ClientConnInterface) PassengerClient {
+	return &passengerClient{cc}
+}
+
+func (c *passengerClient) Check(ctx context.Context, in *PassengerRequest, opts ...grpc.CallOption) (*PassengerResponse, error) {
+	out := new(PassengerResponse)
+	err := c.cc.Invoke(ctx, "/pb.Passenger/Check", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PassengerServer is the server API for Passenger service.
+// All implementations must embed UnimplementedPassengerServer
+// for forward compatibility
+type PassengerServer interface {
+	// Check returns the passenger who may request a ride,
+	// NotFound for an unknown passenger, FailedPrecondition for a blocked one
+	Check(context.Context, *PassengerRequest) (*PassengerResponse, error)
+	mustEmbedUnimplementedPassengerServer()
+}
+
+// UnimplementedPassengerServer must be embedded to have forward compatible implementations.
+type UnimplementedPassengerServer struct {
+}
+
+func (UnimplementedPassengerServer) Check(context.Context, *PassengerRequest) (*PassengerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Check not implemented")
+}
+func (UnimplementedPassengerServer) mustEmbedUnimplementedPassengerServer() {}
+
+// UnsafePassengerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PassengerServer will
+// result in compilation errors.
+type UnsafePassengerServer interface {
+	mustEmbedUnimplementedPassengerServer()
+}
+
+func RegisterPassengerServer(s grpc.ServiceRegistrar, srv PassengerServer) {
+	s.RegisterService(&Passenger_ServiceDesc, srv)
+}
+
+func _Passenger_Check_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PassengerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PassengerServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Passenger/Check",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PassengerServer).Check(ctx, req.(*PassengerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Passenger_ServiceDesc is the grpc.ServiceDesc for Passenger service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Passenger_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.Passenger",
+	HandlerType: (*PassengerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Check",
+			Handler:    _Passenger_Check_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pb/passenger.proto",
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrPasswordTooShort   = errors.New("password must have at least 8 characters")
+)
+
+const minPasswordLen = 8
+
+// hashPassword returns the bcrypt hash the passenger logs in with
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLen {
+		return "", ErrPasswordTooShort
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Login checks the passenger password and returns the passenger ID
+func (s *passengerService) Login(ctx context.Context, email, password string) (uint, error) {
+	var passenger Passenger
+
+	if err := s.slave.First(&passenger, "email = ?", email).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrInvalidCredentials
+		}
+
+		return 0, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(passenger.PasswordHash), []byte(password)) != nil {
+		return 0, ErrInvalidCredentials
+	}
+
+	if passenger.Blocked {
+		return 0, ErrPassengerBlocked
+	}
+
+	return passenger.ID, nil
+}
+
+// CanLogin tells whether the passenger may get new tokens with the refresh token
+func (s *passengerService) CanLogin(ctx context.Context, passengerID uint) error {
+	_, err := s.Check(ctx, passengerID)
+
+	return err
+}
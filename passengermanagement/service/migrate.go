@@ -0,0 +1,29 @@
+package service
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/jadilet/taximicroservice/pkg/migrate"
+	"gorm.io/gorm"
+)
+
+// Migrate prepares the tables of the service, the emails and telephones
+// which would violate the unique indexes are cleared before AutoMigrate
+// creates the indexes
+func Migrate(db *gorm.DB, logger log.Logger) error {
+	// the passengers registered without an email or a telephone or with the
+	// one of an older passenger lose it, they set it again in their profile
+	for column, index := range map[string]string{"email": "idx_passengers_email",
+		"telephone": "idx_passengers_telephone"} {
+		n, err := migrate.ClearDuplicates(db, &Passenger{}, column, index)
+
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			logger.Log("msg", "Empty and duplicate passenger values cleared", "column", column, "count", n)
+		}
+	}
+
+	return db.AutoMigrate(&Passenger{}, &PaymentMethod{})
+}
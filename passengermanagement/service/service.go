@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jadilet/taximicroservice/pkg/validation"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPassengerNotFound     = errors.New("passenger not found")
+	ErrPassengerBlocked      = errors.New("passenger is blocked")
+	ErrPaymentMethodNotFound = errors.New("payment method not found")
+	ErrInvalidPaymentMethod  = errors.New("payment method needs a provider and a reference")
+)
+
+type Passenger struct {
+	gorm.Model
+	UUID          string
+	Name          string
+	Email         string `gorm:"type:varchar(254);uniqueIndex:idx_passengers_email"`
+	Telephone     string `gorm:"type:varchar(32);uniqueIndex:idx_passengers_telephone"`
+	Blocked       bool   `gorm:"default:false"`
+	BlockedReason string `json:",omitempty"`
+	BlockedAt     *time.Time
+	PasswordHash  string `json:"-"`
+}
+
+// PaymentMethod is a reference to a payment method kept by the payment provider,
+// e.g. the provider customer or card token, card numbers are never stored here
+type PaymentMethod struct {
+	gorm.Model
+	PassengerID uint   `gorm:"index"`
+	Provider    string // e.g. stripe
+	Reference   string // the provider ID of the payment method
+	Brand       string // e.g. visa, shown to the passenger
+	Last4       string
+	IsDefault   bool `gorm:"default:false"`
+}
+
+// Profile is the part of the passenger the passenger may change
+type Profile struct {
+	Name      string
+	Email     string
+	Telephone string
+}
+
+type PassengerService interface {
+	Register(ctx context.Context, passenger Passenger, password string) (string, error)
+	Login(ctx context.Context, email, password string) (uint, error)
+	CanLogin(ctx context.Context, passengerID uint) error
+	Get(ctx context.Context, passengerID uint) (Passenger, error)
+	UpdateProfile(ctx context.Context, passengerID uint, profile Profile) (Passenger, error)
+	Block(ctx context.Context, passengerID uint, reason string) (string, error)
+	Unblock(ctx context.Context, passengerID uint) (string, error)
+	Check(ctx context.Context, passengerID uint) (Passenger, error)
+	AddPaymentMethod(ctx context.Context, passengerID uint, method PaymentMethod) (PaymentMethod, error)
+	PaymentMethods(ctx context.Context, passengerID uint) ([]PaymentMethod, error)
+	RemovePaymentMethod(ctx context.Context, passengerID, methodID uint) (string, error)
+}
+
+type passengerService struct {
+	logger log.Logger
+	master *gorm.DB
+	slave  *gorm.DB
+}
+
+func NewPassengerService(log log.Logger, master *gorm.DB, slave *gorm.DB) PassengerService {
+	return &passengerService{logger: log, master: master, slave: slave}
+}
+
+func (s *passengerService) Register(ctx context.Context, passenger Passenger, password string) (string, error) {
+	hash, err := hashPassword(password)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := unique(s.master, 0, passenger.Email, passenger.Telephone); err != nil {
+		return "", err
+	}
+
+	passenger.PasswordHash = hash
+	passenger.Blocked = false
+	passenger.BlockedReason = ""
+	passenger.BlockedAt = nil
+	res := s.master.Create(&passenger)
+
+	if res.Error != nil {
+		return "", duplicate(res.Error)
+	}
+
+	return fmt.Sprintf("Successfully added a new passenger ID: %d", passenger.ID), nil
+}
+
+func (s *passengerService) Get(ctx context.Context, passengerID uint) (Passenger, error) {
+	return find(s.slave, passengerID)
+}
+
+func (s *passengerService) UpdateProfile(ctx context.Context, passengerID uint, profile Profile) (Passenger, error) {
+	passenger, err := find(s.master, passengerID)
+
+	if err != nil {
+		return Passenger{}, err
+	}
+
+	if err := unique(s.master, passengerID, profile.Email, profile.Telephone); err != nil {
+		return Passenger{}, err
+	}
+
+	passenger.Name = profile.Name
+	passenger.Email = profile.Email
+	passenger.Telephone = profile.Telephone
+
+	if err := s.master.Model(&passenger).Select("Name", "Email", "Telephone").
+		Updates(&passenger).Error; err != nil {
+		return Passenger{}, duplicate(err)
+	}
+
+	return passenger, nil
+}
+
+// Block keeps the passenger from logging in and requesting rides
+func (s *passengerService) Block(ctx context.Context, passengerID uint, reason string) (string, error) {
+	if _, err := find(s.master, passengerID); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	if err := s.master.Model(&Passenger{}).Where("id = ?", passengerID).
+		Updates(map[string]interface{}{"blocked": true, "blocked_reason": reason, "blocked_at": &now}).Error; err != nil {
+		return "", err
+	}
+
+	s.logger.Log("Passenger blocked PassengerID=", passengerID, "reason", reason)
+	return fmt.Sprintf("Passenger %d is blocked", passengerID), nil
+}
+
+func (s *passengerService) Unblock(ctx context.Context, passengerID uint) (string, error) {
+	if _, err := find(s.master, passengerID); err != nil {
+		return "", err
+	}
+
+	if err := s.master.Model(&Passenger{}).Where("id = ?", passengerID).
+		Updates(map[string]interface{}{"blocked": false, "blocked_reason": "", "blocked_at": nil}).Error; err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Passenger %d is unblocked", passengerID), nil
+}
+
+// Check returns the passenger if they may request a ride
+func (s *passengerService) Check(ctx context.Context, passengerID uint) (Passenger, error) {
+	passenger, err := find(s.slave, passengerID)
+
+	if err != nil {
+		return Passenger{}, err
+	}
+
+	if passenger.Blocked {
+		return Passenger{}, ErrPassengerBlocked
+	}
+
+	return passenger, nil
+}
+
+// AddPaymentMethod stores the reference, the first method of the passenger is the default one
+func (s *passengerService) AddPaymentMethod(ctx context.Context, passengerID uint,
+	method PaymentMethod) (PaymentMethod, error) {
+	if method.Provider == "" || method.Reference == "" {
+		return PaymentMethod{}, ErrInvalidPaymentMethod
+	}
+
+	if _, err := find(s.master, passengerID); err != nil {
+		return PaymentMethod{}, err
+	}
+
+	method.ID = 0
+	method.PassengerID = passengerID
+
+	err := s.master.Transaction(func(tx *gorm.DB) error {
+		var count int64
+
+		if err := tx.Model(&PaymentMethod{}).Where("passenger_id = ?", passengerID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count == 0 {
+			method.IsDefault = true
+		}
+
+		// one default method per passenger
+		if method.IsDefault && count != 0 {
+			if err := tx.Model(&PaymentMethod{}).Where("passenger_id = ?", passengerID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&method).Error
+	})
+
+	if err != nil {
+		return PaymentMethod{}, err
+	}
+
+	return method, nil
+}
+
+func (s *passengerService) PaymentMethods(ctx context.Context, passengerID uint) ([]PaymentMethod, error) {
+	var methods []PaymentMethod
+
+	if _, err := find(s.slave, passengerID); err != nil {
+		return nil, err
+	}
+
+	if err := s.slave.Where("passenger_id = ?", passengerID).Order("id").Find(&methods).Error; err != nil {
+		return nil, err
+	}
+
+	return methods, nil
+}
+
+func (s *passengerService) RemovePaymentMethod(ctx context.Context, passengerID, methodID uint) (string, error) {
+	res := s.master.Where("id = ? AND passenger_id = ?", methodID, passengerID).Delete(&PaymentMethod{})
+
+	if res.Error != nil {
+		return "", res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return "", ErrPaymentMethodNotFound
+	}
+
+	return fmt.Sprintf("Payment method %d removed", methodID), nil
+}
+
+func find(db *gorm.DB, passengerID uint) (Passenger, error) {
+	var passenger Passenger
+
+	if err := db.First(&passenger, "id = ?", passengerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Passenger{}, ErrPassengerNotFound
+		}
+
+		return Passenger{}, err
+	}
+
+	return passenger, nil
+}
+
+// unique checks no other passenger has the email or the telephone
+func unique(db *gorm.DB, passengerID uint, email, telephone string) error {
+	var errs validation.Errors
+
+	for _, f := range []struct{ column, field, value string }{
+		{"email", "Email", email},
+		{"telephone", "Telephone", telephone},
+	} {
+		var count int64
+
+		if err := db.Model(&Passenger{}).Where(f.column+" = ? AND id <> ?", f.value, passengerID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count != 0 {
+			errs = append(errs, validation.FieldError{Field: f.field, Message: "is already registered"})
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// duplicate returns the field error of a unique index violated
+// by a concurrent registration, the other errors as they are
+func duplicate(err error) error {
+	var mysqlErr *mysql.MySQLError
+
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		return err
+	}
+
+	switch {
+	case strings.Contains(mysqlErr.Message, "idx_passengers_email"):
+		return validation.Field("Email", "is already registered")
+	case strings.Contains(mysqlErr.Message, "idx_passengers_telephone"):
+		return validation.Field("Telephone", "is already registered")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jadilet/taximicroservice/pkg/validation"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testPassword = "secret password"
+
+// newTestService runs the service on an in-memory SQLite database,
+// one connection so every query sees the same database
+func newTestService(t *testing.T) *passengerService {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB, err := db.DB()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&Passenger{}, &PaymentMethod{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return &passengerService{logger: log.NewNopLogger(), master: db, slave: db}
+}
+
+func register(t *testing.T, s *passengerService, email, telephone string) uint {
+	t.Helper()
+
+	ctx := context.Background()
+
+	if _, err := s.Register(ctx, Passenger{Name: "passenger", Email: email, Telephone: telephone},
+		testPassword); err != nil {
+		t.Fatalf("Register(%s) error = %v", email, err)
+	}
+
+	id, err := s.Login(ctx, email, testPassword)
+
+	if err != nil {
+		t.Fatalf("Login(%s) error = %v", email, err)
+	}
+
+	return id
+}
+
+// fields returns the fields of the validation errors
+func fields(err error) []string {
+	var errs validation.Errors
+
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+
+	return fields
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	s := newTestService(t)
+	register(t, s, "a@example.com", "+77000000001")
+
+	tests := []struct {
+		name      string
+		email     string
+		telephone string
+		want      []string
+	}{
+		{"same email", "a@example.com", "+77000000002", []string{"Email"}},
+		{"same telephone", "b@example.com", "+77000000001", []string{"Telephone"}},
+		{"both", "a@example.com", "+77000000001", []string{"Email", "Telephone"}},
+	}
+
+	for _, tt := range tests {
+		_, err := s.Register(context.Background(), Passenger{Email: tt.email, Telephone: tt.telephone},
+			testPassword)
+
+		if got := fields(err); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Register(%s) error = %v, want the fields %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestUpdateProfileDuplicate(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	register(t, s, "a@example.com", "+77000000001")
+	id := register(t, s, "b@example.com", "+77000000002")
+
+	// the passenger keeps their own email and telephone
+	if _, err := s.UpdateProfile(ctx, id, Profile{Name: "b", Email: "b@example.com",
+		Telephone: "+77000000002"}); err != nil {
+		t.Errorf("UpdateProfile with the own email error = %v", err)
+	}
+
+	_, err := s.UpdateProfile(ctx, id, Profile{Name: "b", Email: "a@example.com", Telephone: "+77000000002"})
+
+	if got, want := fields(err), []string{"Email"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UpdateProfile with another email error = %v, want the fields %v", err, want)
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	other := errors.New("connection refused")
+
+	tests := []struct {
+		name string
+		err  error
+		want []string // the fields, nil when the error is returned as it is
+	}{
+		{"email", &mysql.MySQLError{Number: 1062,
+			Message: "Duplicate entry 'a@example.com' for key 'passengers.idx_passengers_email'"}, []string{"Email"}},
+		{"telephone", &mysql.MySQLError{Number: 1062,
+			Message: "Duplicate entry '+77000000001' for key 'idx_passengers_telephone'"}, []string{"Telephone"}},
+		{"other index", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}, nil},
+		{"other mysql error", &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, nil},
+		{"other error", other, nil},
+	}
+
+	for _, tt := range tests {
+		got := duplicate(tt.err)
+
+		if tt.want == nil {
+			if got != tt.err {
+				t.Errorf("duplicate(%s) = %v, want the error as it is", tt.name, got)
+			}
+			continue
+		}
+
+		if fields := fields(got); !reflect.DeepEqual(fields, tt.want) {
+			t.Errorf("duplicate(%s) = %v, want the fields %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoginBlocked(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	id := register(t, s, "a@example.com", "+77000000001")
+
+	if _, err := s.Block(ctx, id, "fraud"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{"blocked", testPassword, ErrPassengerBlocked},
+		// the wrong password doesn't tell the passenger is blocked
+		{"wrong password", "another password", ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		if _, err := s.Login(ctx, "a@example.com", tt.password); err != tt.want {
+			t.Errorf("Login(%s) error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := s.CanLogin(ctx, id); err != ErrPassengerBlocked {
+		t.Errorf("CanLogin error = %v, want %v", err, ErrPassengerBlocked)
+	}
+
+	if _, err := s.Unblock(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := s.Login(ctx, "a@example.com", testPassword); err != nil || got != id {
+		t.Errorf("Login after Unblock = %d, %v, want %d", got, err, id)
+	}
+}
+
+func TestDefaultPaymentMethod(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	id := register(t, s, "a@example.com", "+77000000001")
+
+	steps := []struct {
+		name      string
+		isDefault bool
+		want      []bool // the IsDefault of the methods after the step
+	}{
+		{"first method is the default", false, []bool{true}},
+		{"second method", false, []bool{true, false}},
+		{"new default", true, []bool{false, false, true}},
+	}
+
+	for _, step := range steps {
+		if _, err := s.AddPaymentMethod(ctx, id, PaymentMethod{Provider: "stripe", Reference: "pm_" + step.name,
+			IsDefault: step.isDefault}); err != nil {
+			t.Fatalf("AddPaymentMethod(%s) error = %v", step.name, err)
+		}
+
+		methods, err := s.PaymentMethods(ctx, id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]bool, len(methods))
+		for i, m := range methods {
+			got[i] = m.IsDefault
+		}
+
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: defaults = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	// the other passengers keep their default
+	other := register(t, s, "b@example.com", "+77000000002")
+
+	if _, err := s.AddPaymentMethod(ctx, other, PaymentMethod{Provider: "stripe", Reference: "pm_other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	methods, _ := s.PaymentMethods(ctx, id)
+
+	if len(methods) != 3 || !methods[2].IsDefault {
+		t.Errorf("methods of the first passenger after another passenger added one = %+v", methods)
+	}
+}
@@ -0,0 +1,347 @@
+package transports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/kit/log"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	gt "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/go-kit/kit/transport"
+	"github.com/gorilla/mux"
+	"github.com/jadilet/taximicroservice/passengermanagement/endpoints"
+	"github.com/jadilet/taximicroservice/passengermanagement/pb"
+	"github.com/jadilet/taximicroservice/passengermanagement/service"
+	"github.com/jadilet/taximicroservice/pkg/auth"
+	"github.com/jadilet/taximicroservice/pkg/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type errorer interface {
+	error() error
+}
+
+var (
+	// ErrBadRouting is returned when an expected path variable is missing.
+	// It always indicates programmer error.
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler")
+
+	// ErrInvalidID is returned when the ID in the path isn't a number.
+	ErrInvalidID = errors.New("invalid id")
+)
+
+type gRPCServer struct {
+	check gt.Handler
+	pb.UnimplementedPassengerServer
+}
+
+func NewGRPCServer(endpoint endpoints.EndpointGrpc, logger log.Logger) pb.PassengerServer {
+	return &gRPCServer{
+		check: gt.NewServer(
+			endpoint.Check,
+			decodeCheckRequest,
+			encodeCheckResponse,
+		),
+	}
+}
+
+func (s *gRPCServer) Check(ctx context.Context, req *pb.PassengerRequest) (*pb.PassengerResponse, error) {
+	_, resp, err := s.check.ServeGRPC(ctx, req)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return resp.(*pb.PassengerResponse), nil
+}
+
+// grpcError returns the service errors with their gRPC status codes,
+// the errors of the database are Unavailable so the callers retry later
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrPassengerNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrPassengerBlocked):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
+
+func decodeCheckRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.PassengerRequest)
+
+	return endpoints.PassengerIDReq{PassengerID: uint(req.Passengerid)}, nil
+}
+
+func encodeCheckResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(endpoints.PassengerResp)
+
+	return &pb.PassengerResponse{Passengerid: uint64(resp.Passenger.ID),
+		Name:      resp.Passenger.Name,
+		Telephone: resp.Passenger.Telephone}, nil
+}
+
+// MakeHTTPHandler serves the passenger apps, the requests carry the access token
+// of the passenger or the admin in the Authorization: Bearer header
+func MakeHTTPHandler(s service.PassengerService, keys *auth.Keys, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := endpoints.MakeHttpEndpoint(s, keys)
+
+	options := []httptransport.ServerOption{
+		httptransport.ServerBefore(kitjwt.HTTPToContext()),
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+	}
+
+	r.Methods("POST").Path("/passenger/register/").Handler(
+		httptransport.NewServer(
+			e.Register,
+			decodePostRegisterReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/passenger/login/").Handler(
+		httptransport.NewServer(
+			e.Login,
+			decodePostLoginReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/passenger/token/refresh/").Handler(
+		httptransport.NewServer(
+			e.Refresh,
+			decodePostRefreshReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("GET").Path("/passenger/me").Handler(
+		httptransport.NewServer(
+			e.Profile,
+			decodeMeReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("PUT").Path("/passenger/me").Handler(
+		httptransport.NewServer(
+			e.UpdateProfile,
+			decodePutProfileReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/passenger/me/payment-methods").Handler(
+		httptransport.NewServer(
+			e.AddPaymentMethod,
+			decodePostPaymentMethodReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("GET").Path("/passenger/me/payment-methods").Handler(
+		httptransport.NewServer(
+			e.PaymentMethods,
+			decodeMeReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("DELETE").Path("/passenger/me/payment-methods/{id}").Handler(
+		httptransport.NewServer(
+			e.RemovePaymentMethod,
+			decodePaymentMethodIDReq,
+			encodeResponse,
+			options...,
+		))
+
+	// admin endpoints
+	r.Methods("GET").Path("/passenger/{id:[0-9]+}").Handler(
+		httptransport.NewServer(
+			e.Get,
+			decodePassengerIDReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/passenger/{id:[0-9]+}/block").Handler(
+		httptransport.NewServer(
+			e.Block,
+			decodePostBlockReq,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/passenger/{id:[0-9]+}/unblock").Handler(
+		httptransport.NewServer(
+			e.Unblock,
+			decodePassengerIDReq,
+			encodeResponse,
+			options...,
+		))
+
+	return r
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func decodePostRegisterReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req endpoints.RegisterReq
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodePostLoginReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req endpoints.LoginReq
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodePostRefreshReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req endpoints.RefreshReq
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodeMeReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return endpoints.MeReq{}, nil
+}
+
+func decodePutProfileReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req endpoints.ProfileReq
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodePostPaymentMethodReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req endpoints.PaymentMethodReq
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodePaymentMethodIDReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	methodID, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints.PaymentMethodIDReq{MethodID: methodID}, nil
+}
+
+func decodePassengerIDReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	passengerID, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints.PassengerIDReq{PassengerID: passengerID}, nil
+}
+
+func decodePostBlockReq(_ context.Context, r *http.Request) (request interface{}, err error) {
+	passengerID, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := endpoints.BlockReq{PassengerID: passengerID}
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// pathID reads the {id} path variable
+func pathID(r *http.Request) (uint, error) {
+	vars := mux.Vars(r)
+	v, ok := vars["id"]
+	if !ok {
+		return 0, ErrBadRouting
+	}
+
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidID
+	}
+
+	return uint(id), nil
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+
+	body := map[string]interface{}{
+		"error": err.Error(),
+	}
+
+	// the fields which aren't valid e.g. {"field": "Email", "message": "is required"}
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		body["error"] = "invalid request"
+		body["fields"] = fieldErrs
+	}
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func codeFrom(err error) int {
+	if auth.IsAuthError(err) {
+		return http.StatusUnauthorized
+	}
+
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		return http.StatusBadRequest
+	}
+
+	switch err {
+	case auth.ErrForbidden, service.ErrPassengerBlocked:
+		return http.StatusForbidden
+	case service.ErrInvalidCredentials:
+		return http.StatusUnauthorized
+	case service.ErrPassengerNotFound, service.ErrPaymentMethodNotFound:
+		return http.StatusNotFound
+	case service.ErrPasswordTooShort, service.ErrInvalidPaymentMethod, ErrInvalidID:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,307 @@
+// Package auth issues and verifies the JWT access and refresh tokens
+// of the drivers, the passengers and the admins
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/golang-jwt/jwt/v4"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+)
+
+// the roles of the token subjects
+const (
+	RoleDriver    = "driver"
+	RolePassenger = "passenger"
+	RoleAdmin     = "admin"
+)
+
+const (
+	accessTTL  = 15 * time.Minute
+	refreshTTL = 30 * 24 * time.Hour
+	issuer     = "taximicroservice"
+)
+
+var (
+	// ErrUnauthorized is returned when the request has no valid token
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is returned when the token subject can't access the resource
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrCannotIssue is returned by the services without the signing key
+	ErrCannotIssue = errors.New("tokens can't be issued without the signing key")
+)
+
+// Claims are the claims of the access and the refresh tokens,
+// the subject is the driver or the passenger ID
+type Claims struct {
+	Role    string `json:"role"`
+	Refresh bool   `json:"refresh,omitempty"` // refresh tokens only get new tokens
+	jwt.RegisteredClaims
+}
+
+// Valid checks the expiry and the issuer of the token,
+// the parsers call it after the signature check
+func (c *Claims) Valid() error {
+	if err := c.RegisteredClaims.Valid(); err != nil {
+		return err
+	}
+
+	if !c.VerifyIssuer(issuer, true) {
+		return &jwt.ValidationError{Inner: ErrUnauthorized, Errors: jwt.ValidationErrorIssuer}
+	}
+
+	return nil
+}
+
+// Tokens are issued on login and refresh
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds the access token is valid
+}
+
+// Keys sign and verify the tokens
+type Keys struct {
+	method jwt.SigningMethod
+	sign   interface{} // nil when the service only verifies the tokens
+	verify interface{}
+}
+
+// LoadKeys reads the keys of the environment:
+// AUTH_PUBLIC_KEY_FILE: PEM RSA public key verifying the RS256 tokens
+// AUTH_PRIVATE_KEY_FILE: PEM RSA private key, only the services issuing the tokens have it
+// AUTH_KEY_FILE: shared HS256 secret signing and verifying the tokens, for local runs and tests
+func LoadKeys() (*Keys, error) {
+	if file := os.Getenv("AUTH_KEY_FILE"); file != "" {
+		secret, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		secret = []byte(strings.TrimSpace(string(secret)))
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("AUTH_KEY_FILE %s must have at least 32 bytes", file)
+		}
+
+		return &Keys{method: jwt.SigningMethodHS256, sign: secret, verify: secret}, nil
+	}
+
+	file := os.Getenv("AUTH_PUBLIC_KEY_FILE")
+	if file == "" {
+		return nil, errors.New("AUTH_PUBLIC_KEY_FILE or AUTH_KEY_FILE environment variable required")
+	}
+
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := jwt.ParseRSAPublicKeyFromPEM(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &Keys{method: jwt.SigningMethodRS256, verify: public}
+
+	if file := os.Getenv("AUTH_PRIVATE_KEY_FILE"); file != "" {
+		data, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys.sign, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// Issue returns the access and the refresh tokens of the subject
+func (k *Keys) Issue(subject uint, role string) (Tokens, error) {
+	if k.sign == nil {
+		return Tokens{}, ErrCannotIssue
+	}
+
+	access, err := k.token(subject, role, false, accessTTL)
+
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	refresh, err := k.token(subject, role, true, refreshTTL)
+
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{AccessToken: access, RefreshToken: refresh, ExpiresIn: int(accessTTL.Seconds())}, nil
+}
+
+func (k *Keys) token(subject uint, role string, refresh bool, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Role:    role,
+		Refresh: refresh,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(subject), 10),
+			Issuer:    issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	return jwt.NewWithClaims(k.method, &claims).SignedString(k.sign)
+}
+
+// Refresh checks the refresh token and returns its subject and role,
+// the caller issues the new tokens if the subject can still log in
+func (k *Keys) Refresh(token string) (uint, string, error) {
+	claims, err := k.Parse(token)
+
+	if err != nil {
+		return 0, "", err
+	}
+
+	if !claims.Refresh {
+		return 0, "", ErrUnauthorized
+	}
+
+	subject, err := claims.subject()
+
+	return subject, claims.Role, err
+}
+
+// Parse verifies the signature, the expiry and the issuer of the token and returns its claims
+func (k *Keys) Parse(token string) (*Claims, error) {
+	claims := &Claims{}
+
+	if _, err := jwt.ParseWithClaims(token, claims, k.keyFunc); err != nil {
+		return nil, ErrUnauthorized
+	}
+
+	return claims, nil
+}
+
+func (k *Keys) keyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, kitjwt.ErrUnexpectedSigningMethod
+	}
+
+	return k.verify, nil
+}
+
+// FromRequest verifies the bearer token of the request which isn't served by go-kit e.g. the streams
+func (k *Keys) FromRequest(r *http.Request, roles ...string) (*Claims, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if token == "" {
+		return nil, ErrUnauthorized
+	}
+
+	claims, err := k.Parse(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Refresh || !claims.has(roles) {
+		return nil, ErrForbidden
+	}
+
+	return claims, nil
+}
+
+// Middleware lets through the requests with an access token of one of the roles,
+// the claims are put in the context, see Subject and Role
+func (k *Keys) Middleware(roles ...string) endpoint.Middleware {
+	parser := kitjwt.NewParser(k.keyFunc, k.method, func() jwt.Claims { return &Claims{} })
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return parser(func(ctx context.Context, request interface{}) (interface{}, error) {
+			claims, ok := ctx.Value(kitjwt.JWTClaimsContextKey).(*Claims)
+
+			if !ok {
+				return nil, ErrUnauthorized
+			}
+
+			if claims.Refresh || !claims.has(roles) {
+				return nil, ErrForbidden
+			}
+
+			return next(ctx, request)
+		})
+	}
+}
+
+// Subject returns the driver or the passenger ID of the request token
+func Subject(ctx context.Context) (uint, error) {
+	claims, ok := ctx.Value(kitjwt.JWTClaimsContextKey).(*Claims)
+
+	if !ok {
+		return 0, ErrUnauthorized
+	}
+
+	return claims.subject()
+}
+
+// Role returns the role of the request token
+func Role(ctx context.Context) string {
+	claims, ok := ctx.Value(kitjwt.JWTClaimsContextKey).(*Claims)
+
+	if !ok {
+		return ""
+	}
+
+	return claims.Role
+}
+
+// IsAuthError tells whether the error is a missing or an invalid token
+func IsAuthError(err error) bool {
+	switch err {
+	case ErrUnauthorized, kitjwt.ErrTokenContextMissing, kitjwt.ErrTokenInvalid,
+		kitjwt.ErrTokenExpired, kitjwt.ErrTokenMalformed, kitjwt.ErrTokenNotActive,
+		kitjwt.ErrUnexpectedSigningMethod:
+		return true
+	}
+
+	return false
+}
+
+func (c *Claims) subject() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+
+	if err != nil {
+		return 0, ErrUnauthorized
+	}
+
+	return uint(id), nil
+}
+
+func (c *Claims) has(roles []string) bool {
+	for _, role := range roles {
+		if c.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
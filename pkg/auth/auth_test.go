@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func testKeys() *Keys {
+	return &Keys{method: jwt.SigningMethodHS256, sign: testSecret, verify: testSecret}
+}
+
+func signed(t *testing.T, method jwt.SigningMethod, key interface{}, claims *Claims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func claims(iss string, expiresAt time.Time) *Claims {
+	return &Claims{Role: RoleDriver, RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "7",
+		Issuer:    iss,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}}
+}
+
+func TestParse(t *testing.T) {
+	k := testKeys()
+	later := time.Now().Add(time.Minute)
+
+	issued, err := k.Issue(7, RoleDriver)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"issued", issued.AccessToken, true},
+		{"signed here", signed(t, jwt.SigningMethodHS256, testSecret, claims(issuer, later)), true},
+		{"expired", signed(t, jwt.SigningMethodHS256, testSecret, claims(issuer, time.Now().Add(-time.Minute))), false},
+		{"other issuer", signed(t, jwt.SigningMethodHS256, testSecret, claims("someone", later)), false},
+		{"no issuer", signed(t, jwt.SigningMethodHS256, testSecret, claims("", later)), false},
+		{"other secret", signed(t, jwt.SigningMethodHS256, []byte("another secret of thirty two bytes"),
+			claims(issuer, later)), false},
+		{"other method", signed(t, jwt.SigningMethodHS512, testSecret, claims(issuer, later)), false},
+		{"malformed", "not.a.token", false},
+	}
+
+	for _, tt := range tests {
+		if _, err := k.Parse(tt.token); (err == nil) != tt.valid {
+			t.Errorf("Parse(%s) error = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	k := testKeys()
+	later := time.Now().Add(time.Minute)
+	ok := func(ctx context.Context, request interface{}) (interface{}, error) { return nil, nil }
+
+	issued, err := k.Issue(7, RoleDriver)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		roles []string
+		want  error
+	}{
+		{"driver", issued.AccessToken, []string{RoleDriver}, nil},
+		{"other role", issued.AccessToken, []string{RoleAdmin}, ErrForbidden},
+		{"refresh token", issued.RefreshToken, []string{RoleDriver}, ErrForbidden},
+		{"other issuer", signed(t, jwt.SigningMethodHS256, testSecret, claims("someone", later)),
+			[]string{RoleDriver}, ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		ctx := context.WithValue(context.Background(), kitjwt.JWTContextKey, tt.token)
+
+		if _, err := k.Middleware(tt.roles...)(ok)(ctx, nil); err != tt.want {
+			t.Errorf("Middleware(%s) error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// token issues the access and refresh tokens of any role for local runs and tests e.g.
+//
+//	go run ./pkg/auth/cmd/token -genkey /tmp/auth.key
+//	AUTH_KEY_FILE=/tmp/auth.key go run ./pkg/auth/cmd/token -sub 1 -role admin
+//
+// the services verify the tokens when they run with the same AUTH_KEY_FILE
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/jadilet/taximicroservice/pkg/auth"
+)
+
+func main() {
+	var (
+		genkey  = flag.String("genkey", "", "write a new HS256 secret to the file and exit")
+		subject = flag.Uint("sub", 0, "driver or passenger ID of the token")
+		role    = flag.String("role", auth.RoleDriver, "driver, passenger or admin")
+	)
+	flag.Parse()
+
+	if *genkey != "" {
+		secret := make([]byte, 32)
+
+		if _, err := rand.Read(secret); err != nil {
+			fail(err)
+		}
+
+		if err := ioutil.WriteFile(*genkey, []byte(hex.EncodeToString(secret)), 0600); err != nil {
+			fail(err)
+		}
+
+		return
+	}
+
+	switch *role {
+	case auth.RoleDriver, auth.RolePassenger, auth.RoleAdmin:
+	default:
+		fail(fmt.Errorf("unknown role %q", *role))
+	}
+
+	keys, err := auth.LoadKeys()
+
+	if err != nil {
+		fail(err)
+	}
+
+	tokens, err := keys.Issue(*subject, *role)
+
+	if err != nil {
+		fail(err)
+	}
+
+	_ = json.NewEncoder(os.Stdout).Encode(tokens)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,211 @@
+// Package cancelled keeps the rides the passengers cancelled so the dispatcher
+// and the driver management services stop offering them
+package cancelled
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-redis/redis"
+	"github.com/streadway/amqp"
+)
+
+// RideCancelled is published by the trip management service
+// to the ride_events exchange with the ride.cancelled routing key
+type RideCancelled struct {
+	RideID      uint
+	CancelledAt time.Time
+}
+
+// Rides is the set of the cancelled rides
+type Rides interface {
+	Add(ctx context.Context, rideID uint) error
+	Has(ctx context.Context, rideID uint) (bool, error)
+	// Shared reports whether every replica sees the rides added by the others
+	Shared() bool
+}
+
+// redisRides keeps the cancelled rides in redis, shared by all the replicas
+// so a restarted or a new replica knows the earlier cancellations
+type redisRides struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisRides keeps every cancelled ride in the <prefix>.<ride ID> key for ttl
+func NewRedisRides(rdb redis.UniversalClient, prefix string, ttl time.Duration) Rides {
+	return &redisRides{rdb: rdb, prefix: prefix, ttl: ttl}
+}
+
+func (r *redisRides) Add(ctx context.Context, rideID uint) error {
+	return r.rdb.Set(ctx, r.key(rideID), 1, r.ttl).Err()
+}
+
+func (r *redisRides) Has(ctx context.Context, rideID uint) (bool, error) {
+	n, err := r.rdb.Exists(ctx, r.key(rideID)).Result()
+
+	if err != nil {
+		return false, err
+	}
+
+	return n != 0, nil
+}
+
+func (r *redisRides) Shared() bool {
+	return true
+}
+
+func (r *redisRides) key(rideID uint) string {
+	return fmt.Sprintf("%s.%d", r.prefix, rideID)
+}
+
+// memoryRides keeps the cancelled rides in the process
+// for local runs without redis, every replica has its own
+type memoryRides struct {
+	mutex sync.RWMutex
+	ttl   time.Duration
+	rides map[uint]time.Time
+}
+
+// NewMemoryRides keeps every cancelled ride for ttl
+func NewMemoryRides(ttl time.Duration) Rides {
+	return &memoryRides{ttl: ttl, rides: make(map[uint]time.Time)}
+}
+
+func (m *memoryRides) Add(ctx context.Context, rideID uint) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	m.rides[rideID] = now
+
+	for id, t := range m.rides {
+		if now.Sub(t) > m.ttl {
+			delete(m.rides, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryRides) Has(ctx context.Context, rideID uint) (bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	t, ok := m.rides[rideID]
+	return ok && time.Since(t) <= m.ttl, nil
+}
+
+func (m *memoryRides) Shared() bool {
+	return false
+}
+
+// FromEnv keeps the cancelled rides in the redis cluster of REDIS_CLUSTER_ADDRS
+// e.g. redis-master:6379, or in the redis of REDIS_HOST, REDIS_PORT and REDIS_DB,
+// REDIS_USER and REDIS_PASSWORD authenticate both. Without them the rides
+// are kept in the process.
+func FromEnv(ttl time.Duration) (Rides, error) {
+	if addrs := os.Getenv("REDIS_CLUSTER_ADDRS"); addrs != "" {
+		return NewRedisRides(redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    strings.Split(addrs, ","),
+			Username: os.Getenv("REDIS_USER"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+		}), "rides.cancelled", ttl), nil
+	}
+
+	if os.Getenv("REDIS_HOST") == "" {
+		return NewMemoryRides(ttl), nil
+	}
+
+	redisURL := fmt.Sprintf("redis://%s:%s@%s:%s/%s",
+		os.Getenv("REDIS_USER"),
+		os.Getenv("REDIS_PASSWORD"),
+		os.Getenv("REDIS_HOST"),
+		os.Getenv("REDIS_PORT"),
+		os.Getenv("REDIS_DB"),
+	)
+
+	opt, err := redis.ParseURL(redisURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRedisRides(redis.NewClient(opt), "rides.cancelled", ttl), nil
+}
+
+// Watch adds the rides of the ride.cancelled events to the set.
+// A shared set is filled from the durable queue, one replica records each
+// cancellation and the events published while the service is down wait there.
+// Every replica binds its own queue to fill a set which isn't shared.
+func Watch(ctx context.Context, ch *amqp.Channel, rides Rides, queue string, logger log.Logger) error {
+	durable, autoDelete, exclusive := true, false, false
+
+	if !rides.Shared() {
+		queue, durable, autoDelete, exclusive = "", false, true, true
+	}
+
+	q, err := ch.QueueDeclare(
+		queue,      // name
+		durable,    // durable
+		autoDelete, // delete when unused
+		exclusive,  // exclusive
+		false,      // no-wait
+		nil,        // arguments
+	)
+
+	if err != nil {
+		logger.Log("Failed to declare a ride cancellation queue", err)
+		return err
+	}
+
+	err = ch.QueueBind(q.Name, "ride.cancelled", "ride_events", false, nil)
+
+	if err != nil {
+		logger.Log("Failed to bind the ride cancellation queue", err)
+		return err
+	}
+
+	msgs, err := ch.Consume(q.Name, "", false, exclusive, false, false, nil)
+
+	if err != nil {
+		logger.Log("Failed to register a ride cancellation consumer", err)
+		return err
+	}
+
+	go func() {
+		for d := range msgs {
+			var event RideCancelled
+
+			if err := json.Unmarshal(d.Body, &event); err != nil {
+				logger.Log("Failed parse ride cancellation message body", err)
+				if err := d.Nack(false, false); err != nil {
+					logger.Log("Error negative acknowledging the message", err)
+				}
+				continue
+			}
+
+			if err := rides.Add(ctx, event.RideID); err != nil {
+				logger.Log("Error recording the ride cancellation RideID=", event.RideID, "err", err)
+				if err := d.Nack(false, true); err != nil {
+					logger.Log("Error negative acknowledging the message", err)
+				}
+				continue
+			}
+
+			if err := d.Ack(false); err != nil {
+				logger.Log("Error acknowledging the message", err)
+			}
+			logger.Log("Ride cancelled RideID=", event.RideID)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package cancelled
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryRides(t *testing.T) {
+	ctx := context.Background()
+	rides := NewMemoryRides(time.Hour).(*memoryRides)
+
+	rides.Add(ctx, 1)
+	rides.Add(ctx, 2)
+	// cancelled before the ttl
+	rides.rides[2] = time.Now().Add(-2 * time.Hour)
+
+	tests := []struct {
+		rideID uint
+		want   bool
+	}{
+		{1, true},
+		{2, false},
+		{3, false},
+	}
+
+	for _, tt := range tests {
+		if got, err := rides.Has(ctx, tt.rideID); got != tt.want || err != nil {
+			t.Errorf("Has(%d) = %v, %v, want %v", tt.rideID, got, err, tt.want)
+		}
+	}
+
+	// the expired rides are dropped on the next Add
+	rides.Add(ctx, 3)
+
+	if _, ok := rides.rides[2]; ok || len(rides.rides) != 2 {
+		t.Errorf("rides after Add = %v, want the expired ride dropped", rides.rides)
+	}
+}
@@ -0,0 +1,54 @@
+// Package migrate fixes the rows of the existing tables which would violate
+// the unique indexes AutoMigrate adds to them
+package migrate
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ClearDuplicates prepares the column of the model table for the unique index:
+// the empty values and the values an older row has become NULL, MySQL unique
+// indexes allow any number of NULLs. It does nothing when the table is missing
+// or already has the index, it returns the number of rows cleared.
+func ClearDuplicates(db *gorm.DB, model interface{}, column, index string) (int64, error) {
+	migrator := db.Migrator()
+
+	if !migrator.HasTable(model) || migrator.HasIndex(model, index) {
+		return 0, nil
+	}
+
+	stmt := &gorm.Statement{DB: db}
+
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+
+	table := clause.Table{Name: stmt.Schema.Table}
+	var cleared int64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec("UPDATE ? SET ? = NULL WHERE ? = ''", table, clause.Column{Name: column},
+			clause.Column{Name: column})
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		cleared = res.RowsAffected
+
+		// the oldest row keeps the value
+		res = tx.Exec(`UPDATE ?
+			JOIN (SELECT ? AS dup, MIN(id) AS id FROM ? WHERE ? IS NOT NULL GROUP BY ? HAVING COUNT(*) > 1) keep
+			ON ? = keep.dup AND t.id <> keep.id
+			SET ? = NULL`,
+			clause.Table{Name: stmt.Schema.Table, Alias: "t"}, clause.Column{Name: column}, table,
+			clause.Column{Name: column}, clause.Column{Name: column},
+			clause.Column{Table: "t", Name: column}, clause.Column{Table: "t", Name: column})
+
+		cleared += res.RowsAffected
+		return res.Error
+	})
+
+	return cleared, err
+}
@@ -0,0 +1,172 @@
+// Package mtls configures the TLS of the gRPC servers and clients of the services
+// and checks the identity of the callers
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var ErrNoClientCert = errors.New("no verified client certificate")
+
+// Config is the TLS configuration of the gRPC servers and clients
+type Config struct {
+	cert *tls.Certificate
+	ca   *x509.CertPool
+}
+
+// Rules lists the identities allowed to call the methods e.g. /pb.Driver/Send,
+// the methods without a rule are open to every service with a valid certificate
+type Rules map[string][]string
+
+// FromEnv reads the configuration of the environment, plaintext when none is set:
+// GRPC_TLS_CERT_FILE, GRPC_TLS_KEY_FILE: PEM certificate and key of the service,
+// the common name of the certificate is the identity of the service e.g. dispatcher
+// GRPC_TLS_CA_FILE: PEM CA verifying the certificates of the other services,
+// the servers require the client certificates (mTLS) when it is set
+func FromEnv() (*Config, error) {
+	var c Config
+
+	certFile, keyFile := os.Getenv("GRPC_TLS_CERT_FILE"), os.Getenv("GRPC_TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE must be set together")
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.cert = &cert
+	}
+
+	if file := os.Getenv("GRPC_TLS_CA_FILE"); file != "" {
+		data, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.ca = x509.NewCertPool()
+		if !c.ca.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("GRPC_TLS_CA_FILE %s has no PEM certificate", file)
+		}
+	}
+
+	return &c, nil
+}
+
+// Mutual tells whether the server verifies the callers and checks the rules
+func (c *Config) Mutual() bool {
+	return c.cert != nil && c.ca != nil
+}
+
+// ServerOptions returns the credentials of the server and, with mTLS,
+// the interceptors checking the identity of the callers against the rules
+func (c *Config) ServerOptions(rules Rules) []grpc.ServerOption {
+	if c.cert == nil {
+		return nil
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{*c.cert}, MinVersion: tls.VersionTLS12}
+
+	if c.ca == nil {
+		return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(config))}
+	}
+
+	config.ClientCAs = c.ca
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return []grpc.ServerOption{
+		grpc.Creds(credentials.NewTLS(config)),
+		grpc.UnaryInterceptor(rules.unary),
+		grpc.StreamInterceptor(rules.stream),
+	}
+}
+
+// DialOption returns the credentials of the client, the service certificate
+// is sent to the servers requiring the client certificates
+func (c *Config) DialOption() grpc.DialOption {
+	if c.cert == nil && c.ca == nil {
+		return grpc.WithInsecure()
+	}
+
+	// the system roots verify the servers without GRPC_TLS_CA_FILE
+	config := &tls.Config{RootCAs: c.ca, MinVersion: tls.VersionTLS12}
+
+	if c.cert != nil {
+		config.Certificates = []tls.Certificate{*c.cert}
+	}
+
+	return grpc.WithTransportCredentials(credentials.NewTLS(config))
+}
+
+// Identity returns the common name of the verified certificate of the caller
+func Identity(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+
+	if !ok {
+		return "", ErrNoClientCert
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", ErrNoClientCert
+	}
+
+	return info.State.VerifiedChains[0][0].Subject.CommonName, nil
+}
+
+func (r Rules) check(ctx context.Context, method string) error {
+	identity, err := Identity(ctx)
+
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	allowed, ok := r[method]
+
+	if !ok {
+		return nil
+	}
+
+	for _, name := range allowed {
+		if name == identity {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.PermissionDenied, "%s can't call %s", identity, method)
+}
+
+func (r Rules) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if err := r.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (r Rules) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	if err := r.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
@@ -0,0 +1,154 @@
+// Package queues has the retry and the dead letter queues of the ride queues
+package queues
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/streadway/amqp"
+)
+
+// DeadLetterExchange routes the rejected messages to the <queue>.dlq queues.
+// The ride queues were declared without arguments and RabbitMQ refuses
+// to redeclare them with other ones, the rides-dlx policy sets it on them,
+// see dispatcher/deployments/rabbitmq.
+const DeadLetterExchange = "rides.dlx"
+
+// retryDelays are the backoff steps of the transient failures,
+// every step has its own delay queue, the message is parked
+// in the dead letter queue after the last step
+var retryDelays = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	15 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// RetryQueue is the delay queue of the retry step
+func RetryQueue(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", queue, delay)
+}
+
+// DeadLetterQueue is the queue the poison messages of the queue are parked in
+func DeadLetterQueue(queue string) string {
+	return queue + ".dlq"
+}
+
+// DeclareRetryQueues declares the delay queues of the queue,
+// expired messages go back to the queue
+func DeclareRetryQueues(ch *amqp.Channel, queue string) error {
+	for _, delay := range retryDelays {
+		_, err := ch.QueueDeclare(
+			RetryQueue(queue, delay), // name
+			true,                     // durable
+			false,                    // delete when unused
+			false,                    // exclusive
+			false,                    // no-wait
+			amqp.Table{
+				"x-message-ttl":             int32(delay.Milliseconds()),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queue,
+			},
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeclareDeadLetterQueue declares the dead letter exchange
+// and binds the dead letter queue of the queue to it
+func DeclareDeadLetterQueue(ch *amqp.Channel, queue string) error {
+	err := ch.ExchangeDeclare(DeadLetterExchange, "direct", true, false, false, false, nil)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.QueueDeclare(DeadLetterQueue(queue), true, false, false, false, nil)
+
+	if err != nil {
+		return err
+	}
+
+	return ch.QueueBind(DeadLetterQueue(queue), queue, DeadLetterExchange, false, nil)
+}
+
+// Retries counts how many times the message went through the delay queues of the queue
+func Retries(d amqp.Delivery, queue string) int {
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	count := 0
+
+	for _, death := range deaths {
+		table, ok := death.(amqp.Table)
+		if !ok {
+			continue
+		}
+
+		name, _ := table["queue"].(string)
+		if reason, _ := table["reason"].(string); reason != "expired" ||
+			!strings.HasPrefix(name, queue+".retry.") {
+			continue
+		}
+
+		switch n := table["count"].(type) {
+		case int64:
+			count += int(n)
+		case int32:
+			count += int(n)
+		}
+	}
+
+	return count
+}
+
+// Retry puts the message to the next delay queue,
+// the message is parked in the dead letter queue when the retries are exhausted
+func Retry(ch *amqp.Channel, d amqp.Delivery, queue string, logger log.Logger) {
+	n := Retries(d, queue)
+
+	if n >= len(retryDelays) {
+		logger.Log("Retries exhausted, message parked in", DeadLetterQueue(queue))
+		if err := d.Nack(false, false); err != nil {
+			logger.Log("Error negative acknowledging the message", err)
+		}
+		return
+	}
+
+	err := ch.Publish(
+		"",
+		RetryQueue(queue, retryDelays[n]),
+		false,
+		false,
+		amqp.Publishing{
+			Headers:      d.Headers,
+			DeliveryMode: amqp.Persistent,
+			ContentType:  d.ContentType,
+			Body:         d.Body,
+		})
+
+	if err != nil {
+		logger.Log("Error to write a message to", RetryQueue(queue, retryDelays[n]), "err", err)
+		if err := d.Nack(false, true); err != nil {
+			logger.Log("Error negative acknowledging the message", err)
+		}
+		return
+	}
+
+	if err := d.Ack(false); err != nil {
+		logger.Log("Error acknowledging the message", err)
+	}
+}
+
+// Reject parks the poison message in the dead letter queue
+func Reject(d amqp.Delivery, logger log.Logger) {
+	if err := d.Nack(false, false); err != nil {
+		logger.Log("Error negative acknowledging the message", err)
+	}
+}
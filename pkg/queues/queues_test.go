@@ -0,0 +1,64 @@
+package queues
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func death(queue, reason string, count interface{}) amqp.Table {
+	return amqp.Table{"queue": queue, "reason": reason, "count": count}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name   string
+		deaths []interface{}
+		want   int
+	}{
+		{"first delivery", nil, 0},
+		{"one retry", []interface{}{death("open_ride_queue.retry.1s", "expired", int64(1))}, 1},
+		{"every step", []interface{}{
+			death("open_ride_queue.retry.5s", "expired", int64(1)),
+			death("open_ride_queue.retry.1s", "expired", int32(1)),
+		}, 2},
+		{"the same step again", []interface{}{death("open_ride_queue.retry.1m0s", "expired", int64(3))}, 3},
+		// the response and the delay queues aren't retries
+		{"other queues", []interface{}{
+			death("open_ride_delay", "expired", int64(4)),
+			death("waiting_driver_response.retry.1s", "expired", int64(1)),
+			death("open_ride_queue.retry.1s", "expired", int64(1)),
+		}, 1},
+		{"rejected", []interface{}{death("open_ride_queue.retry.1s", "rejected", int64(1))}, 0},
+		{"bad headers", []interface{}{"open_ride_queue.retry.1s", death("open_ride_queue.retry.1s", "expired", "2")},
+			0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := amqp.Delivery{Headers: amqp.Table{"x-death": tt.deaths}}
+
+			if got := Retries(d, "open_ride_queue"); got != tt.want {
+				t.Errorf("Retries = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueNames(t *testing.T) {
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{RetryQueue("open_ride_queue", time.Second), "open_ride_queue.retry.1s"},
+		{RetryQueue("waiting_driver_response", time.Minute), "waiting_driver_response.retry.1m0s"},
+		{DeadLetterQueue("open_ride_queue"), "open_ride_queue.dlq"},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("queue name %q, want %q", tt.got, tt.want)
+		}
+	}
+}
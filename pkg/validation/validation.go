@@ -0,0 +1,146 @@
+// Package validation validates the decoded requests and reports the invalid fields
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is a field of the request which isn't valid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors are the field errors of a request, the transports answer them with 400
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, f := range e {
+		msgs = append(msgs, strings.TrimSpace(f.Field+" "+f.Message))
+	}
+
+	return "invalid request: " + strings.Join(msgs, ", ")
+}
+
+// Field returns the error of a single field e.g. an email which is already registered
+func Field(field, message string) Errors {
+	return Errors{{Field: field, Message: message}}
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	// the fields are named as in the JSON body
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return f.Name
+		}
+
+		return name
+	})
+
+	return v
+}
+
+// Struct checks the validate tags of the request
+func Struct(req interface{}) error {
+	err := validate.Struct(req)
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	errs := make(Errors, 0, len(fieldErrs))
+	for _, f := range fieldErrs {
+		errs = append(errs, FieldError{Field: f.Field(), Message: message(f)})
+	}
+
+	return errs
+}
+
+// Decode reads the JSON body into the request and checks it
+func Decode(body io.Reader, req interface{}) error {
+	if err := json.NewDecoder(body).Decode(req); err != nil {
+		var typeErr *json.UnmarshalTypeError
+
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return Field(typeErr.Field, "must be a "+jsonType(typeErr.Type))
+		}
+
+		return Field("body", "must be a JSON object")
+	}
+
+	return Struct(req)
+}
+
+// jsonType names the JSON type of the Go type of a field
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	default:
+		return "JSON object"
+	}
+}
+
+func message(f validator.FieldError) string {
+	switch f.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be an email address"
+	case "e164":
+		return "must be a telephone number in the E.164 format e.g. +77011234567"
+	case "latitude":
+		return "must be a latitude between -90 and 90"
+	case "longitude":
+		return "must be a longitude between -180 and 180"
+	case "numeric":
+		return "must be a number"
+	case "uuid":
+		return "must be a UUID"
+	case "alphanum":
+		return "must have only letters and digits"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(f.Param(), " ", ", ")
+	case "len":
+		return "must have " + f.Param() + " characters"
+	case "min", "max":
+		limit := "at least"
+		if f.Tag() == "max" {
+			limit = "at most"
+		}
+
+		if f.Kind() == reflect.String {
+			return fmt.Sprintf("must have %s %s characters", limit, f.Param())
+		}
+
+		return fmt.Sprintf("must be %s %s", limit, f.Param())
+	default:
+		return "is not valid"
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -10,9 +11,13 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/jadilet/taximicroservice/passengermanagement/pb"
+	"github.com/jadilet/taximicroservice/pkg/auth"
+	"github.com/jadilet/taximicroservice/pkg/mtls"
 	"github.com/jadilet/taximicroservice/tripmanagement/service"
 	"github.com/jadilet/taximicroservice/tripmanagement/transports"
 	"github.com/streadway/amqp"
+	"google.golang.org/grpc"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/mysql"
@@ -65,6 +70,8 @@ func main() {
 
 	defer ch.Close()
 
+	// rejected rides are parked in open_ride_queue.dlq by the rides.dlx exchange,
+	// the rides-dlx policy sets it, see dispatcher/deployments/rabbitmq
 	_, err = ch.QueueDeclare(
 		"open_ride_queue", // name
 		true,              // durable
@@ -79,6 +86,69 @@ func main() {
 		return
 	}
 
+	// ride_events: ride status changes published by the services
+	// e.g. ride.cancelled when the passenger cancels the ride
+	err = ch.ExchangeDeclare(
+		"ride_events", // name
+		"topic",       // type
+		true,          // durable
+		false,         // auto-deleted
+		false,         // internal
+		false,         // no-wait
+		nil,           // arguments
+	)
+
+	if err != nil {
+		logger.Log("Failed to declare an exchange ride_events", err)
+		return
+	}
+
+	// ride_accepted: the driver management service publishes ride.accepted
+	// when a driver accepts the ride, the ride is assigned to the driver
+	_, err = ch.QueueDeclare(
+		"ride_accepted", // name
+		true,            // durable
+		false,           // delete when unused
+		false,           // exclusive
+		false,           // no-wait
+		nil,             // arguments
+	)
+
+	if err != nil {
+		logger.Log("Failed to declare a queue ride_accepted", err)
+		return
+	}
+
+	err = ch.QueueBind("ride_accepted", "ride.accepted", "ride_events", false, nil)
+
+	if err != nil {
+		logger.Log("Failed to bind the queue ride_accepted", err)
+		return
+	}
+
+	// ride_no_drivers: the dispatcher publishes ride.no_drivers
+	// when it didn't find any driver for the ride
+	_, err = ch.QueueDeclare(
+		"ride_no_drivers", // name
+		true,              // durable
+		false,             // delete when unused
+		false,             // exclusive
+		false,             // no-wait
+		nil,               // arguments
+	)
+
+	if err != nil {
+		logger.Log("Failed to declare a queue ride_no_drivers", err)
+		return
+	}
+
+	err = ch.QueueBind("ride_no_drivers", "ride.no_drivers", "ride_events", false, nil)
+
+	if err != nil {
+		logger.Log("Failed to bind the queue ride_no_drivers", err)
+		return
+	}
+
 	dnsMaster := fmt.Sprintf(
 		"%s:%s@%s(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 		os.Getenv("MYSQL_USER"),
@@ -113,8 +183,67 @@ func main() {
 		return
 	}
 
-	s := service.NewTripService(logger, masterDB, slaveDB, ch)
-	h := transports.MakeHTTPHandler(s, log.With(logger, "component", "HTTP"))
+	// AUTH_PUBLIC_KEY_FILE: PEM RSA public key verifying the tokens issued by the other services
+	// AUTH_KEY_FILE: shared HS256 secret instead of the RSA keys for local runs and tests
+	keys, err := auth.LoadKeys()
+
+	if err != nil {
+		logger.Log("Failed to load the auth keys", err)
+		return
+	}
+
+	// GRPC_TLS_CERT_FILE, GRPC_TLS_KEY_FILE, GRPC_TLS_CA_FILE: see mtls.FromEnv,
+	// the certificate of tripmanagement lets it check the passengers
+	tlsConfig, err := mtls.FromEnv()
+
+	if err != nil {
+		logger.Log("Failed to load the gRPC TLS configuration", err)
+		return
+	}
+
+	// Grpc client of PassengerManagement service
+	addr := fmt.Sprintf("%s:%s",
+		os.Getenv("GRPC_PASSENGERMANAGEMENT_SRV_NAME"),
+		os.Getenv("GRPC_PASSENGERMANAGEMENT_SRV_PORT"))
+
+	grpcPassengerSrvConn, err := grpc.Dial(addr, tlsConfig.DialOption())
+	if err != nil {
+		logger.Log("Can't connect to GRPC PassengerManagement service server", err)
+		return
+	}
+
+	defer grpcPassengerSrvConn.Close()
+
+	passengerClient := pb.NewPassengerClient(grpcPassengerSrvConn)
+
+	s := service.NewTripService(logger, masterDB, slaveDB, ch, passengerClient)
+	h := transports.MakeHTTPHandler(s, keys, log.With(logger, "component", "HTTP"))
+
+	go func(s service.TripService) {
+		err := s.ConsumeAccepted(context.Background())
+
+		if err != nil {
+			logger.Log("Error ConsumeAccepted function", err)
+		}
+	}(s)
+
+	go func(s service.TripService) {
+		err := s.ConsumeNoDrivers(context.Background())
+
+		if err != nil {
+			logger.Log("Error ConsumeNoDrivers function", err)
+		}
+	}(s)
+
+	// ride.cancelled and ride.completed are written to the outbox with the ride change
+	// and published from there, every replica relays them
+	go func(s service.TripService) {
+		err := s.RelayOutbox(context.Background())
+
+		if err != nil {
+			logger.Log("Error RelayOutbox function", err)
+		}
+	}(s)
 
 	errs := make(chan error)
 	go func() {
@@ -142,7 +271,7 @@ func dbConnection(dns string, maxIdleConns, maxOpenConns int, isMaster bool) (*g
 	}
 
 	if isMaster {
-		err = db.AutoMigrate(&service.Ride{})
+		err = db.AutoMigrate(&service.Ride{}, &service.RideStatusHistory{}, &service.OutboxEvent{})
 
 		if err != nil {
 			return nil, err
@@ -2,17 +2,35 @@ package endpoints
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/jadilet/taximicroservice/pkg/auth"
 	"github.com/jadilet/taximicroservice/tripmanagement/service"
 )
 
 type Endpoint struct {
-	AddRide endpoint.Endpoint
+	AddRide       endpoint.Endpoint
+	GetRide       endpoint.Endpoint
+	History       endpoint.Endpoint
+	Dispatching   endpoint.Endpoint
+	AssignDriver  endpoint.Endpoint
+	DriverArrived endpoint.Endpoint
+	StartRide     endpoint.Endpoint
+	CompleteRide  endpoint.Endpoint
+	CancelRide    endpoint.Endpoint
+	ExpireRide    endpoint.Endpoint
 }
 
+// RideReq has the fields a passenger sets on a ride request, the passenger
+// is the one of the token, the status and the driver are set by the service.
+// The coordinates are pointers so a 0 latitude or longitude isn't taken for a missing one.
 type RideReq struct {
-	Ride service.Ride
+	UUID         string   `validate:"omitempty,uuid"`
+	Lat          *float64 `validate:"required,latitude"`
+	Lon          *float64 `validate:"required,longitude"`
+	Addr         string   `validate:"required,max=255"`
+	VehicleClass string   `validate:"omitempty,alphanum,max=32"`
 }
 
 type RideResp struct {
@@ -20,15 +38,151 @@ type RideResp struct {
 	Err error  `json:"error,omitempty"`
 }
 
+type RideIDReq struct {
+	ID uint
+}
+
+type AssignDriverReq struct {
+	ID       uint   `json:"-"`
+	DriverID string `validate:"required,numeric"`
+}
+
+type GetRideResp struct {
+	Ride service.Ride `json:"ride"`
+	Err  error        `json:"error,omitempty"`
+}
+
+type HistoryResp struct {
+	History []service.RideStatusHistory `json:"history"`
+	Err     error                       `json:"error,omitempty"`
+}
+
 func makeAddRideEndpoint(s service.TripService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(RideReq)
-		msg, err := s.AddRide(ctx, req.Ride)
+		passengerID, err := auth.Subject(ctx)
+
+		if err != nil {
+			return RideResp{Err: err}, err
+		}
+
+		msg, err := s.AddRide(ctx, service.Ride{
+			UUID:         req.UUID,
+			PassengerID:  strconv.FormatUint(uint64(passengerID), 10),
+			Lat:          *req.Lat,
+			Lon:          *req.Lon,
+			Addr:         req.Addr,
+			VehicleClass: req.VehicleClass,
+		})
+		return RideResp{Msg: msg, Err: err}, err
+	}
+}
+
+func makeGetRideEndpoint(s service.TripService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RideIDReq)
+		ride, err := s.GetRide(ctx, req.ID)
+		return GetRideResp{Ride: ride, Err: err}, err
+	}
+}
+
+func makeHistoryEndpoint(s service.TripService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RideIDReq)
+		history, err := s.History(ctx, req.ID)
+		return HistoryResp{History: history, Err: err}, err
+	}
+}
+
+func makeAssignDriverEndpoint(s service.TripService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(AssignDriverReq)
+		msg, err := s.AssignDriver(ctx, req.ID, req.DriverID)
 		return RideResp{Msg: msg, Err: err}, err
 	}
 }
-func MakeEndpoint(s service.TripService) Endpoint {
+
+// makeTransitionEndpoint wraps the TripService methods
+// which only need the ride ID to move the ride to the next status
+func makeTransitionEndpoint(transition func(ctx context.Context, rideID uint) (string, error)) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RideIDReq)
+		msg, err := transition(ctx, req.ID)
+		return RideResp{Msg: msg, Err: err}, err
+	}
+}
+
+// rideAccess lets through the admins and, of the roles, the passenger of the ride
+// and the driver assigned to it
+func rideAccess(s service.TripService, roles ...string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			role := auth.Role(ctx)
+
+			if role == auth.RoleAdmin {
+				return next(ctx, request)
+			}
+
+			var rideID uint
+			switch req := request.(type) {
+			case RideIDReq:
+				rideID = req.ID
+			case AssignDriverReq:
+				rideID = req.ID
+			}
+
+			subject, err := auth.Subject(ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			passengerID, driverID, err := s.RideParties(ctx, rideID)
+
+			if err != nil {
+				return nil, err
+			}
+
+			id := strconv.FormatUint(uint64(subject), 10)
+			for _, r := range roles {
+				if r != role {
+					continue
+				}
+
+				if (role == auth.RolePassenger && passengerID == id) ||
+					(role == auth.RoleDriver && driverID == id) {
+					return next(ctx, request)
+				}
+			}
+
+			return nil, auth.ErrForbidden
+		}
+	}
+}
+
+// MakeEndpoint returns the trip endpoints, the passengers create rides and follow
+// their own rides, the drivers move their rides along, the ride lifecycle
+// driven by the other services needs an admin token
+func MakeEndpoint(s service.TripService, keys *auth.Keys) Endpoint {
+	var (
+		passenger = keys.Middleware(auth.RolePassenger)
+		anyone    = keys.Middleware(auth.RolePassenger, auth.RoleDriver, auth.RoleAdmin)
+		driver    = keys.Middleware(auth.RoleDriver, auth.RoleAdmin)
+		admin     = keys.Middleware(auth.RoleAdmin)
+		owner     = rideAccess(s, auth.RolePassenger, auth.RoleDriver)
+		assigned  = rideAccess(s, auth.RoleDriver)
+	)
+
 	return Endpoint{
-		AddRide: makeAddRideEndpoint(s),
+		AddRide:       passenger(makeAddRideEndpoint(s)),
+		GetRide:       anyone(owner(makeGetRideEndpoint(s))),
+		History:       anyone(owner(makeHistoryEndpoint(s))),
+		Dispatching:   admin(makeTransitionEndpoint(s.Dispatching)),
+		AssignDriver:  admin(makeAssignDriverEndpoint(s)),
+		DriverArrived: driver(assigned(makeTransitionEndpoint(s.DriverArrived))),
+		StartRide:     driver(assigned(makeTransitionEndpoint(s.StartRide))),
+		CompleteRide:  driver(assigned(makeTransitionEndpoint(s.CompleteRide))),
+		CancelRide:    anyone(owner(makeTransitionEndpoint(s.CancelRide))),
+		ExpireRide:    admin(makeTransitionEndpoint(s.ExpireRide)),
 	}
 }
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/streadway/amqp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	outboxInterval = 5 * time.Second
+	outboxBatch    = 100
+)
+
+// OutboxEvent is an event written in the transaction of the ride change,
+// RelayOutbox publishes it after the commit so a broker failure
+// can't lose the event of a change which is already saved
+type OutboxEvent struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	Exchange   string `gorm:"type:varchar(64)"`
+	RoutingKey string `gorm:"type:varchar(64)"`
+	Body       []byte
+}
+
+// addEvent writes the event of the ride_events exchange to the outbox of the transaction
+func addEvent(tx *gorm.DB, routingKey string, event interface{}) error {
+	data, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&OutboxEvent{Exchange: "ride_events", RoutingKey: routingKey, Body: data}).Error
+}
+
+// RelayOutbox publishes the outbox events and deletes them, every few seconds
+// and right after a ride change wrote an event. The replicas relay different
+// batches at the same time so the events aren't published in order, and an event
+// may be published twice when the delete fails after the publish. The consumers
+// don't rely on the order: they check the state of the ride before applying
+// an event and ignore the changes they already applied.
+func (srv *tripService) RelayOutbox(ctx context.Context) error {
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := srv.relay(ctx)
+
+			if err != nil {
+				srv.logger.Log("Error relaying the outbox events", err)
+				break
+			}
+
+			if n < outboxBatch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-srv.outboxReady:
+		}
+	}
+}
+
+// relay publishes a batch of the outbox events, the rows are locked with
+// SKIP LOCKED so the replicas relay different events
+func (srv *tripService) relay(ctx context.Context) (int, error) {
+	var published []uint
+	var publishErr error
+
+	err := srv.masterDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events []OutboxEvent
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Order("id").Limit(outboxBatch).Find(&events).Error; err != nil {
+			return err
+		}
+
+		for _, e := range events {
+			publishErr = srv.ch.Publish(
+				e.Exchange,   // exchange
+				e.RoutingKey, // routing key
+				false,        // mandatory
+				false,
+				amqp.Publishing{
+					DeliveryMode: amqp.Persistent,
+					ContentType:  "application/json",
+					Body:         e.Body,
+				})
+
+			// the events after the failed one wait for the next round
+			if publishErr != nil {
+				break
+			}
+
+			published = append(published, e.ID)
+		}
+
+		if len(published) == 0 {
+			return nil
+		}
+
+		return tx.Delete(&OutboxEvent{}, published).Error
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(published), publishErr
+}
+
+// outboxWritten wakes up the relay of the replica after a commit
+func (srv *tripService) outboxWritten() {
+	select {
+	case srv.outboxReady <- struct{}{}:
+	default:
+	}
+}
@@ -5,48 +5,192 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jadilet/taximicroservice/passengermanagement/pb"
 	"github.com/streadway/amqp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
-	ErrInconsistentIDs = errors.New("inconsistent IDs")
-	ErrAlreadyExists   = errors.New("already exists")
-	ErrNotFound        = errors.New("not found")
+	ErrInconsistentIDs   = errors.New("inconsistent IDs")
+	ErrAlreadyExists     = errors.New("already exists")
+	ErrNotFound          = errors.New("not found")
+	ErrPassengerNotFound = errors.New("passenger not found")
+	ErrPassengerBlocked  = errors.New("passenger is blocked")
+	ErrActiveRide        = errors.New("passenger already has an active ride")
 )
 
+// RideStatus is a step of the ride lifecycle
+type RideStatus string
+
+const (
+	StatusRequested      RideStatus = "requested"
+	StatusDispatching    RideStatus = "dispatching"
+	StatusDriverAssigned RideStatus = "driver_assigned"
+	StatusDriverArrived  RideStatus = "driver_arrived"
+	StatusInProgress     RideStatus = "in_progress"
+	StatusCompleted      RideStatus = "completed"
+	StatusCancelled      RideStatus = "cancelled"
+	StatusExpired        RideStatus = "expired"
+	StatusNoDrivers      RideStatus = "no_drivers_available"
+)
+
+// transitions lists the statuses a ride may move to from each status.
+// Completed, cancelled, expired and no drivers available are final.
+var transitions = map[RideStatus][]RideStatus{
+	StatusRequested:      {StatusDispatching, StatusCancelled, StatusExpired, StatusNoDrivers},
+	StatusDispatching:    {StatusDriverAssigned, StatusCancelled, StatusExpired, StatusNoDrivers},
+	StatusDriverAssigned: {StatusDriverArrived, StatusCancelled},
+	StatusDriverArrived:  {StatusInProgress, StatusCancelled},
+	StatusInProgress:     {StatusCompleted},
+}
+
+// createRideAttempts is how many times a ride is created when
+// the concurrent requests deadlock
+const createRideAttempts = 3
+
+// activeStatuses are the statuses of the rides which aren't over,
+// a passenger has at most one ride in them
+var activeStatuses = []RideStatus{StatusRequested, StatusDispatching, StatusDriverAssigned,
+	StatusDriverArrived, StatusInProgress}
+
+// CanTransition reports whether a ride in status from may move to status to
+func CanTransition(from, to RideStatus) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// InvalidTransitionError is returned when a ride can't move
+// from its current status to the requested one
+type InvalidTransitionError struct {
+	RideID uint
+	From   RideStatus
+	To     RideStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("ride %d can't move from %s to %s", e.RideID, e.From, e.To)
+}
+
 type Ride struct {
 	gorm.Model
-	UUID        string
-	PassengerID string
+	UUID         string
+	PassengerID  string `gorm:"type:varchar(32);index"`
+	DriverID     string
+	Lat          float64
+	Lon          float64
+	Addr         string
+	VehicleClass string     // any class when empty
+	Status       RideStatus `gorm:"type:varchar(32);index;default:requested"`
+	AcceptedAt   *time.Time
+}
+
+// RideStatusHistory records every status change of a ride
+type RideStatusHistory struct {
+	gorm.Model
+	RideID     uint       `gorm:"index"`
+	FromStatus RideStatus `gorm:"type:varchar(32)"`
+	ToStatus   RideStatus `gorm:"type:varchar(32)"`
+	ChangedAt  time.Time
+}
+
+// RideCancelled is published to the ride_events exchange
+// with the ride.cancelled routing key
+type RideCancelled struct {
+	RideID      uint
+	CancelledAt time.Time
+}
+
+// RideAccepted is published by the driver management service
+// to the ride_events exchange with the ride.accepted routing key
+type RideAccepted struct {
+	RideID     uint
+	DriverID   uint
+	AcceptedAt time.Time
+}
+
+// RideNoDrivers is published by the dispatcher service to the ride_events
+// exchange with the ride.no_drivers routing key when no driver was found
+type RideNoDrivers struct {
+	RideID   uint
+	Attempts int
+	Radius   float64
+	At       time.Time
+}
+
+// RideCompleted is published to the ride_events exchange
+// with the ride.completed routing key
+type RideCompleted struct {
+	RideID      uint
 	DriverID    string
-	Lat         float64
-	Lon         float64
-	Addr        string
+	CompletedAt time.Time
 }
 
 type TripService interface {
 	AddRide(ctx context.Context, ride Ride) (string, error)
+	GetRide(ctx context.Context, rideID uint) (Ride, error)
+	RideParties(ctx context.Context, rideID uint) (passengerID, driverID string, err error)
+	History(ctx context.Context, rideID uint) ([]RideStatusHistory, error)
+	Dispatching(ctx context.Context, rideID uint) (string, error)
+	AssignDriver(ctx context.Context, rideID uint, driverID string) (string, error)
+	DriverArrived(ctx context.Context, rideID uint) (string, error)
+	StartRide(ctx context.Context, rideID uint) (string, error)
+	CompleteRide(ctx context.Context, rideID uint) (string, error)
+	CancelRide(ctx context.Context, rideID uint) (string, error)
+	ExpireRide(ctx context.Context, rideID uint) (string, error)
+	ConsumeAccepted(ctx context.Context) error
+	ConsumeNoDrivers(ctx context.Context) error
+	RelayOutbox(ctx context.Context) error
 }
 
 type tripService struct {
-	logger log.Logger
-	masterDB *gorm.DB
-	slaveDB  *gorm.DB
-	ch *amqp.Channel
+	logger      log.Logger
+	masterDB    *gorm.DB
+	slaveDB     *gorm.DB
+	ch          *amqp.Channel
+	passengers  pb.PassengerClient
+	outboxReady chan struct{}
 }
 
-func NewTripService(log log.Logger, master *gorm.DB,slave *gorm.DB, ch *amqp.Channel) TripService {
-	return &tripService{logger: log, masterDB: master, slaveDB: slave, ch: ch}
+func NewTripService(log log.Logger, master *gorm.DB, slave *gorm.DB, ch *amqp.Channel,
+	passengers pb.PassengerClient) TripService {
+	return &tripService{logger: log, masterDB: master, slaveDB: slave, ch: ch, passengers: passengers,
+		outboxReady: make(chan struct{}, 1)}
 }
 
+// AddRide creates the ride of a registered passenger who isn't blocked
+// and has no other active ride, then sends it to the dispatcher
 func (srv *tripService) AddRide(ctx context.Context, ride Ride) (string, error) {
-	res := srv.masterDB.Create(&ride)
+	if err := srv.checkPassenger(ctx, ride.PassengerID); err != nil {
+		return "", err
+	}
+
+	ride.Status = StatusRequested
+	req := ride
+
+	err := srv.createRide(ctx, &ride)
 
-	if res.Error != nil {
-		return "", res.Error
+	// the rolled back request tries again, it finds the ride
+	// of the other request when both were of the passenger
+	for attempt := 1; deadlock(err) && attempt < createRideAttempts; attempt++ {
+		ride = req
+		err = srv.createRide(ctx, &ride)
+	}
+
+	if err != nil {
+		return "", err
 	}
 
 	data, err := json.Marshal(&ride)
@@ -67,8 +211,323 @@ func (srv *tripService) AddRide(ctx context.Context, ride Ride) (string, error)
 		})
 
 	if err != nil {
+		// nobody dispatches the ride, it expires so the passenger may request another one
+		srv.logger.Log("Error publishing the ride RideID", ride.ID, "err", err)
+
+		if _, expireErr := srv.transition(ctx, ride.ID, StatusExpired, nil); expireErr != nil {
+			srv.logger.Log("Error expiring the ride RideID", ride.ID, "err", expireErr)
+		}
+
 		return "", err
 	}
 
+	srv.logger.Log("RideID", ride.ID, "status", ride.Status)
 	return fmt.Sprintf("ride added id: %d", ride.ID), nil
 }
+
+// createRide writes the dispatching ride unless the passenger has an active one.
+// The active rides of the passenger are locked so two requests of the passenger
+// can't both create a ride, the gap locks of the count make the concurrent inserts
+// deadlock and MySQL rolls one of them back, see createRideAttempts.
+func (srv *tripService) createRide(ctx context.Context, ride *Ride) error {
+	return srv.masterDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var active int64
+
+		if err := tx.Model(&Ride{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("passenger_id = ? AND status IN ?", ride.PassengerID, activeStatuses).
+			Count(&active).Error; err != nil {
+			return err
+		}
+
+		if active != 0 {
+			return ErrActiveRide
+		}
+
+		if err := tx.Create(ride).Error; err != nil {
+			return err
+		}
+
+		// the ride is dispatching before it is published so the events
+		// of the dispatcher always find it in a status they may move it from
+		return moveRide(tx, ride, StatusDispatching, nil)
+	})
+}
+
+// deadlock reports whether MySQL rolled the transaction back to break a deadlock
+func deadlock(err error) bool {
+	var mysqlErr *mysql.MySQLError
+
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1213
+}
+
+// checkPassenger asks the passenger management service whether the passenger may request a ride
+func (srv *tripService) checkPassenger(ctx context.Context, passengerID string) error {
+	id, err := strconv.ParseUint(passengerID, 10, 64)
+
+	if err != nil {
+		return ErrPassengerNotFound
+	}
+
+	_, err = srv.passengers.Check(ctx, &pb.PassengerRequest{Passengerid: id})
+
+	switch status.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.NotFound:
+		return ErrPassengerNotFound
+	case codes.FailedPrecondition:
+		return ErrPassengerBlocked
+	default:
+		return err
+	}
+}
+
+func (srv *tripService) GetRide(ctx context.Context, rideID uint) (Ride, error) {
+	var ride Ride
+
+	if err := srv.slaveDB.First(&ride, rideID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Ride{}, ErrNotFound
+		}
+		return Ride{}, err
+	}
+
+	return ride, nil
+}
+
+// RideParties returns the passenger and the driver of the ride for the access
+// checks, it reads the master so the driver is let in as soon as they're assigned
+func (srv *tripService) RideParties(ctx context.Context, rideID uint) (string, string, error) {
+	var ride Ride
+
+	err := srv.masterDB.WithContext(ctx).Select("id", "passenger_id", "driver_id").First(&ride, rideID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", ErrNotFound
+		}
+		return "", "", err
+	}
+
+	return ride.PassengerID, ride.DriverID, nil
+}
+
+func (srv *tripService) History(ctx context.Context, rideID uint) ([]RideStatusHistory, error) {
+	var history []RideStatusHistory
+
+	if _, err := srv.GetRide(ctx, rideID); err != nil {
+		return nil, err
+	}
+
+	if err := srv.slaveDB.Where("ride_id = ?", rideID).Order("id").Find(&history).Error; err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (srv *tripService) Dispatching(ctx context.Context, rideID uint) (string, error) {
+	return srv.transition(ctx, rideID, StatusDispatching, nil)
+}
+
+func (srv *tripService) AssignDriver(ctx context.Context, rideID uint, driverID string) (string, error) {
+	if driverID == "" {
+		return "", ErrInconsistentIDs
+	}
+
+	return srv.transition(ctx, rideID, StatusDriverAssigned, func(ride *Ride) {
+		ride.DriverID = driverID
+	})
+}
+
+func (srv *tripService) DriverArrived(ctx context.Context, rideID uint) (string, error) {
+	return srv.transition(ctx, rideID, StatusDriverArrived, nil)
+}
+
+func (srv *tripService) StartRide(ctx context.Context, rideID uint) (string, error) {
+	return srv.transition(ctx, rideID, StatusInProgress, nil)
+}
+
+// CompleteRide completes the ride and frees the driver for the next ride
+func (srv *tripService) CompleteRide(ctx context.Context, rideID uint) (string, error) {
+	return srv.change(ctx, rideID, StatusCompleted, nil, "ride.completed", func(ride Ride) interface{} {
+		return RideCompleted{RideID: ride.ID, DriverID: ride.DriverID, CompletedAt: time.Now().UTC()}
+	})
+}
+
+// CancelRide cancels the ride and tells the dispatcher and
+// the driver management services to stop offering it
+func (srv *tripService) CancelRide(ctx context.Context, rideID uint) (string, error) {
+	return srv.change(ctx, rideID, StatusCancelled, nil, "ride.cancelled", func(ride Ride) interface{} {
+		return RideCancelled{RideID: ride.ID, CancelledAt: time.Now().UTC()}
+	})
+}
+
+func (srv *tripService) ExpireRide(ctx context.Context, rideID uint) (string, error) {
+	return srv.transition(ctx, rideID, StatusExpired, nil)
+}
+
+// ConsumeAccepted assigns the driver who accepted the ride,
+// the ride_accepted queue is shared by all the replicas
+func (srv *tripService) ConsumeAccepted(ctx context.Context) error {
+	return srv.consume(ctx, "ride_accepted", func(body []byte) error {
+		var event RideAccepted
+
+		if err := json.Unmarshal(body, &event); err != nil {
+			return err
+		}
+
+		_, err := srv.transition(ctx, event.RideID, StatusDriverAssigned, func(ride *Ride) {
+			acceptedAt := event.AcceptedAt
+			ride.DriverID = strconv.FormatUint(uint64(event.DriverID), 10)
+			ride.AcceptedAt = &acceptedAt
+		})
+
+		return err
+	})
+}
+
+// ConsumeNoDrivers marks the rides the dispatcher gave up on,
+// the ride_no_drivers queue is shared by all the replicas
+func (srv *tripService) ConsumeNoDrivers(ctx context.Context) error {
+	return srv.consume(ctx, "ride_no_drivers", func(body []byte) error {
+		var event RideNoDrivers
+
+		if err := json.Unmarshal(body, &event); err != nil {
+			return err
+		}
+
+		_, err := srv.transition(ctx, event.RideID, StatusNoDrivers, nil)
+
+		return err
+	})
+}
+
+// consume runs handle for every message of the queue.
+// Messages the handle can't apply to the ride (unknown ride, invalid transition)
+// are dropped, the other errors requeue the message.
+func (srv *tripService) consume(ctx context.Context, queue string, handle func(body []byte) error) error {
+	msgs, err := srv.ch.Consume(
+		queue, // queue
+		"",    // consumer
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+
+	if err != nil {
+		srv.logger.Log("Failed to register a consumer to", queue, "err", err)
+		return err
+	}
+
+	forever := make(chan bool)
+
+	go func() {
+		for d := range msgs {
+			err := handle(d.Body)
+
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			var transitionErr *InvalidTransitionError
+			switch {
+			case err == nil:
+			case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+				srv.logger.Log("Failed parse message body of", queue, "err", err)
+				if err := d.Nack(false, false); err != nil {
+					srv.logger.Log("Error negative acknowledging the message", err)
+				}
+				continue
+			case errors.Is(err, ErrNotFound), errors.As(err, &transitionErr):
+				// the ride was cancelled or expired meanwhile, nothing to retry
+				srv.logger.Log("Message dropped", queue, "err", err)
+			default:
+				srv.logger.Log("Error handling message of", queue, "err", err)
+				if err := d.Nack(false, true); err != nil {
+					srv.logger.Log("Error negative acknowledging the message", err)
+				}
+				continue
+			}
+
+			if err := d.Ack(false); err != nil {
+				srv.logger.Log("Error acknowledging the message", err)
+			}
+		}
+	}()
+
+	srv.logger.Log(" [*] Waiting", queue, "for messages.")
+	<-forever
+
+	return nil
+}
+
+// transition moves the ride to the status to inside a transaction,
+// the ride row is locked so concurrent transitions are serialized.
+// update may change other ride fields before it is saved.
+func (srv *tripService) transition(ctx context.Context, rideID uint, to RideStatus, update func(*Ride)) (string, error) {
+	return srv.change(ctx, rideID, to, update, "", nil)
+}
+
+// change is transition which also writes the event of the changed ride
+// with the routing key to the outbox when event isn't nil
+func (srv *tripService) change(ctx context.Context, rideID uint, to RideStatus, update func(*Ride),
+	routingKey string, event func(Ride) interface{}) (string, error) {
+	err := srv.masterDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ride Ride
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ride, rideID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if err := moveRide(tx, &ride, to, update); err != nil {
+			return err
+		}
+
+		if event == nil {
+			return nil
+		}
+
+		return addEvent(tx, routingKey, event(ride))
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if event != nil {
+		srv.outboxWritten()
+	}
+
+	srv.logger.Log("RideID", rideID, "status", to)
+	return fmt.Sprintf("ride %d is %s", rideID, to), nil
+}
+
+// moveRide moves the ride, locked or created by the transaction tx,
+// to the status to and records the change
+func moveRide(tx *gorm.DB, ride *Ride, to RideStatus, update func(*Ride)) error {
+	from := ride.Status
+
+	if !CanTransition(from, to) {
+		return &InvalidTransitionError{RideID: ride.ID, From: from, To: to}
+	}
+
+	ride.Status = to
+
+	if update != nil {
+		update(ride)
+	}
+
+	if err := tx.Save(ride).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&RideStatusHistory{
+		RideID:     ride.ID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedAt:  time.Now().UTC(),
+	}).Error
+}
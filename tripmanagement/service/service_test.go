@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from RideStatus
+		to   RideStatus
+		want bool
+	}{
+		{StatusRequested, StatusDispatching, true},
+		{StatusRequested, StatusCancelled, true},
+		{StatusRequested, StatusExpired, true},
+		{StatusRequested, StatusNoDrivers, true},
+		{StatusRequested, StatusDriverAssigned, false},
+		{StatusRequested, StatusCompleted, false},
+		{StatusDispatching, StatusDriverAssigned, true},
+		{StatusDispatching, StatusCancelled, true},
+		{StatusDispatching, StatusExpired, true},
+		{StatusDispatching, StatusNoDrivers, true},
+		{StatusDispatching, StatusRequested, false},
+		{StatusDispatching, StatusInProgress, false},
+		{StatusDriverAssigned, StatusDriverArrived, true},
+		{StatusDriverAssigned, StatusCancelled, true},
+		{StatusDriverAssigned, StatusNoDrivers, false},
+		{StatusDriverAssigned, StatusCompleted, false},
+		{StatusDriverArrived, StatusInProgress, true},
+		{StatusDriverArrived, StatusCancelled, true},
+		{StatusDriverArrived, StatusDriverAssigned, false},
+		{StatusInProgress, StatusCompleted, true},
+		{StatusInProgress, StatusCancelled, false},
+		{StatusInProgress, StatusDriverArrived, false},
+		// the final statuses
+		{StatusCompleted, StatusInProgress, false},
+		{StatusCompleted, StatusCancelled, false},
+		{StatusCancelled, StatusDispatching, false},
+		{StatusCancelled, StatusCancelled, false},
+		{StatusExpired, StatusDispatching, false},
+		{StatusNoDrivers, StatusDispatching, false},
+		// the same status isn't a transition
+		{StatusDispatching, StatusDispatching, false},
+		{"unknown", StatusDispatching, false},
+		{StatusRequested, "unknown", false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestFinalStatuses(t *testing.T) {
+	active := map[RideStatus]bool{}
+	for _, s := range activeStatuses {
+		active[s] = true
+	}
+
+	for _, s := range []RideStatus{StatusRequested, StatusDispatching, StatusDriverAssigned, StatusDriverArrived,
+		StatusInProgress, StatusCompleted, StatusCancelled, StatusExpired, StatusNoDrivers} {
+		// a ride is active until it reaches a final status
+		if final := len(transitions[s]) == 0; final == active[s] {
+			t.Errorf("status %s: final %v, active %v", s, final, active[s])
+		}
+	}
+}
+
+func TestDeadlock(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}, true},
+		{fmt.Errorf("create ride: %w", &mysql.MySQLError{Number: 1213}), true},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, false},
+		{ErrActiveRide, false},
+		{errors.New("deadlock"), false},
+	}
+
+	for _, tt := range tests {
+		if got := deadlock(tt.err); got != tt.want {
+			t.Errorf("deadlock(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
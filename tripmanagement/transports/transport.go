@@ -4,15 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
 	"github.com/go-kit/kit/transport"
 	"github.com/gorilla/mux"
+	"github.com/jadilet/taximicroservice/pkg/auth"
+	"github.com/jadilet/taximicroservice/pkg/validation"
 	"github.com/jadilet/taximicroservice/tripmanagement/endpoints"
 	"github.com/jadilet/taximicroservice/tripmanagement/service"
 
 	httptransport "github.com/go-kit/kit/transport/http"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type errorer interface {
@@ -23,13 +32,19 @@ var (
 	// ErrBadRouting is returned when an expected path variable is missing.
 	// It always indicates programmer error.
 	ErrBadRouting = errors.New("inconsistent mapping between route and handler")
+
+	// ErrInvalidID is returned when the ride ID in the path isn't a number.
+	ErrInvalidID = errors.New("invalid ride id")
 )
 
-func MakeHTTPHandler(s service.TripService, logger log.Logger) http.Handler {
+// MakeHTTPHandler serves the trips, the requests carry the access token
+// of the passenger, the driver or the admin in the Authorization: Bearer header
+func MakeHTTPHandler(s service.TripService, keys *auth.Keys, logger log.Logger) http.Handler {
 	r := mux.NewRouter()
-	e := endpoints.MakeEndpoint(s)
+	e := endpoints.MakeEndpoint(s, keys)
 
 	options := []httptransport.ServerOption{
+		httptransport.ServerBefore(kitjwt.HTTPToContext()),
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
 	}
@@ -42,6 +57,57 @@ func MakeHTTPHandler(s service.TripService, logger log.Logger) http.Handler {
 			options...,
 		))
 
+	r.Methods("GET").Path("/trip/{id}").Handler(
+		httptransport.NewServer(
+			e.GetRide,
+			decodeRideIDRequest,
+			encodeResponse,
+			options...,
+		))
+
+	// passenger cancellation
+	r.Methods("DELETE").Path("/trip/{id}").Handler(
+		httptransport.NewServer(
+			e.CancelRide,
+			decodeRideIDRequest,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("GET").Path("/trip/{id}/history").Handler(
+		httptransport.NewServer(
+			e.History,
+			decodeRideIDRequest,
+			encodeResponse,
+			options...,
+		))
+
+	r.Methods("POST").Path("/trip/{id}/assign").Handler(
+		httptransport.NewServer(
+			e.AssignDriver,
+			decodeAssignDriverRequest,
+			encodeResponse,
+			options...,
+		))
+
+	// transitions that only need the ride ID
+	for path, ep := range map[string]endpoint.Endpoint{
+		"/trip/{id}/dispatching": e.Dispatching,
+		"/trip/{id}/arrived":     e.DriverArrived,
+		"/trip/{id}/start":       e.StartRide,
+		"/trip/{id}/complete":    e.CompleteRide,
+		"/trip/{id}/cancel":      e.CancelRide,
+		"/trip/{id}/expire":      e.ExpireRide,
+	} {
+		r.Methods("POST").Path(path).Handler(
+			httptransport.NewServer(
+				ep,
+				decodeRideIDRequest,
+				encodeResponse,
+				options...,
+			))
+	}
+
 	return r
 }
 
@@ -56,13 +122,57 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 
 func decodePostTripRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	var req endpoints.RideReq
-	if e := json.NewDecoder(r.Body).Decode(&req.Ride); e != nil {
-		return nil, e
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	// 0, 0 is what the phones without a GPS fix report, not a pickup
+	if math.Abs(*req.Lat) < 1e-4 && math.Abs(*req.Lon) < 1e-4 {
+		return nil, validation.Field("Lat", "must not be the null island 0, 0")
 	}
 
 	return req, nil
 }
 
+func decodeRideIDRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := rideID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints.RideIDReq{ID: id}, nil
+}
+
+func decodeAssignDriverRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := rideID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := endpoints.AssignDriverReq{ID: id}
+	if err := validation.Decode(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// rideID reads the ride ID from the {id} path variable
+func rideID(r *http.Request) (uint, error) {
+	vars := mux.Vars(r)
+	v, ok := vars["id"]
+	if !ok {
+		return 0, ErrBadRouting
+	}
+
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidID
+	}
+
+	return uint(id), nil
+}
+
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
 		panic("encodeError with nil error")
@@ -70,16 +180,50 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(codeFrom(err))
 
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+	body := map[string]interface{}{
 		"error": err.Error(),
-	})
+	}
+
+	// the fields which aren't valid e.g. {"field": "Lat", "message": "is required"}
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		body["error"] = "invalid request"
+		body["fields"] = fieldErrs
+	}
+
+	_ = json.NewEncoder(w).Encode(body)
 }
 
 func codeFrom(err error) int {
+	var transitionErr *service.InvalidTransitionError
+	if errors.As(err, &transitionErr) {
+		return http.StatusConflict
+	}
+
+	if auth.IsAuthError(err) {
+		return http.StatusUnauthorized
+	}
+
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		return http.StatusBadRequest
+	}
+
+	// the errors of the passenger management service
+	if status.Code(err) == codes.Unavailable {
+		return http.StatusServiceUnavailable
+	}
+
 	switch err {
+	case auth.ErrForbidden, service.ErrPassengerBlocked:
+		return http.StatusForbidden
+	case service.ErrPassengerNotFound:
+		return http.StatusNotFound
+	case service.ErrActiveRide:
+		return http.StatusConflict
 	case service.ErrNotFound:
 		return http.StatusNotFound
-	case service.ErrAlreadyExists, service.ErrInconsistentIDs:
+	case service.ErrAlreadyExists, service.ErrInconsistentIDs, ErrInvalidID:
 		return http.StatusBadRequest
 	default:
 		return http.StatusInternalServerError